@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/mdblp/shoreline/token"
+)
+
+const (
+	// grant type of the Auth0 machine to machine tokens
+	clientCredentialsGrantType = "client-credentials"
+	// suffix of the subject of the Auth0 machine to machine tokens: "<client id>@clients"
+	clientSubjectSuffix = "@clients"
+)
+
+// Claims are the claims of a bearer token which are not part of token.TokenData
+type Claims struct {
+	Subject  string
+	Issuer   string
+	Audience []string
+	// Scopes granted to the token, from the space separated scope claim
+	Scopes        []string
+	EmailVerified bool
+}
+
+// HasScopes tells whether all the given scopes are granted, it is false on nil claims
+func (c *Claims) HasScopes(scopes ...string) bool {
+	if c == nil {
+		return false
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasAudience tells whether the token was issued for the given audience, it is false on nil claims
+func (c *Claims) HasAudience(audience string) bool {
+	return c != nil && slices.Contains(c.Audience, audience)
+}
+
+// tokenData maps the claims of a validated bearer token to the token data of the request
+//
+// User tokens have a "<connection>|<user id>" subject (auth0|123, google-oauth2|123) and the roles in the role claim.
+// Machine to machine tokens have a "<client id>@clients" subject, a client-credentials grant type and usually no role:
+// their user id is the client id and they are server tokens.
+func (client *Client) tokenData(claims *validator.ValidatedClaims, rawToken string) (*token.TokenData, *Claims, error) {
+	customClaims, _ := claims.CustomClaims.(*CustomClaims)
+	if customClaims == nil {
+		customClaims = &CustomClaims{}
+	}
+	subject := claims.RegisteredClaims.Subject
+	isMachine := customClaims.GrantType == clientCredentialsGrantType || strings.HasSuffix(subject, clientSubjectSuffix)
+
+	var userID string
+	if isMachine {
+		userID = strings.TrimSuffix(subject, clientSubjectSuffix)
+	} else if _, id, found := strings.Cut(subject, "|"); found {
+		userID = id
+	}
+	if userID == "" {
+		return nil, nil, newAuthError(KindInvalidClaims, fmt.Errorf("malformed subject [%s]", subject))
+	}
+
+	role, err := client.role(rawToken)
+	if err != nil {
+		return nil, nil, newAuthError(KindInvalidClaims, err)
+	}
+	tokenData := &token.TokenData{UserId: userID, IsServer: customClaims.IsServer || isMachine, Role: role}
+	return tokenData, &Claims{
+		Subject:       subject,
+		Issuer:        claims.RegisteredClaims.Issuer,
+		Audience:      claims.RegisteredClaims.Audience,
+		Scopes:        customClaims.Scopes(),
+		EmailVerified: customClaims.EmailVerified,
+	}, nil
+}
+
+// role reads the role claim of a token, which is either a string or an array of strings
+func (client *Client) role(rawToken string) (string, error) {
+	var payload map[string]interface{}
+	if err := decodeJwtPart(rawToken, 1, &payload); err != nil {
+		return "", err
+	}
+	switch roles := payload[client.roleClaim].(type) {
+	case nil:
+	case string:
+		if roles != "" {
+			return roles, nil
+		}
+	case []interface{}:
+		if len(roles) > 0 {
+			role, ok := roles[0].(string)
+			if !ok {
+				return "", fmt.Errorf("claim [%s] is not an array of strings", client.roleClaim)
+			}
+			return role, nil
+		}
+	default:
+		return "", fmt.Errorf("claim [%s] is neither a string nor an array of strings", client.roleClaim)
+	}
+	return client.defaultRole, nil
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_AuthenticateClaimShapes(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := issuer.newClient(t)
+
+	tests := []struct {
+		name         string
+		claims       map[string]interface{}
+		expected     *token.TokenData
+		expectedKind string
+	}{
+		{
+			name:     "auth0 user with roles",
+			claims:   map[string]interface{}{"sub": "auth0|123456789", DefaultRoleClaim: []string{"hcp", "caregiver"}},
+			expected: &token.TokenData{UserId: "123456789", Role: "hcp"},
+		},
+		{
+			name:     "social connection user",
+			claims:   map[string]interface{}{"sub": "google-oauth2|10769150350006150715113082367", DefaultRoleClaim: []string{"patient"}},
+			expected: &token.TokenData{UserId: "10769150350006150715113082367", Role: "patient"},
+		},
+		{
+			name:     "enterprise connection user with a separator in the id",
+			claims:   map[string]interface{}{"sub": "samlp|yourloops|user@example.com", DefaultRoleClaim: []string{"hcp"}},
+			expected: &token.TokenData{UserId: "yourloops|user@example.com", Role: "hcp"},
+		},
+		{
+			name:     "role as a string",
+			claims:   map[string]interface{}{DefaultRoleClaim: "caregiver"},
+			expected: &token.TokenData{UserId: "123456789", Role: "caregiver"},
+		},
+		{
+			name:     "user without role claim",
+			claims:   map[string]interface{}{DefaultRoleClaim: nil},
+			expected: &token.TokenData{UserId: "123456789", Role: ""},
+		},
+		{
+			name:     "user with an empty role list",
+			claims:   map[string]interface{}{DefaultRoleClaim: []string{}},
+			expected: &token.TokenData{UserId: "123456789", Role: ""},
+		},
+		{
+			name:     "user flagged as server",
+			claims:   map[string]interface{}{"isServer": true},
+			expected: &token.TokenData{UserId: "123456789", Role: "hcp", IsServer: true},
+		},
+		{
+			name:     "machine to machine token",
+			claims:   map[string]interface{}{"sub": "AbCdEf123@clients", "gty": "client-credentials", DefaultRoleClaim: nil},
+			expected: &token.TokenData{UserId: "AbCdEf123", IsServer: true},
+		},
+		{
+			name:     "machine to machine token without grant type",
+			claims:   map[string]interface{}{"sub": "AbCdEf123@clients", DefaultRoleClaim: nil},
+			expected: &token.TokenData{UserId: "AbCdEf123", IsServer: true},
+		},
+		{
+			name:     "machine to machine token with a role",
+			claims:   map[string]interface{}{"sub": "AbCdEf123@clients", "gty": "client-credentials", DefaultRoleClaim: []string{"server"}},
+			expected: &token.TokenData{UserId: "AbCdEf123", IsServer: true, Role: "server"},
+		},
+		{
+			name:         "subject without separator",
+			claims:       map[string]interface{}{"sub": "123456789"},
+			expectedKind: KindInvalidClaims,
+		},
+		{
+			name:         "subject without user id",
+			claims:       map[string]interface{}{"sub": "auth0|"},
+			expectedKind: KindInvalidClaims,
+		},
+		{
+			name:         "missing subject",
+			claims:       map[string]interface{}{"sub": nil},
+			expectedKind: KindInvalidClaims,
+		},
+		{
+			name:         "machine to machine token without client id",
+			claims:       map[string]interface{}{"sub": "@clients"},
+			expectedKind: KindInvalidClaims,
+		},
+		{
+			name:         "roles which are not strings",
+			claims:       map[string]interface{}{DefaultRoleClaim: []int{1, 2}},
+			expectedKind: KindInvalidClaims,
+		},
+		{
+			name:         "role claim of an unexpected type",
+			claims:       map[string]interface{}{DefaultRoleClaim: map[string]string{"role": "hcp"}},
+			expectedKind: KindInvalidClaims,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data", nil)
+			req.Header.Set("Authorization", "Bearer "+issuer.sign(t, issuer.key, tt.claims))
+			tokenData, err := client.AuthenticateWithError(req)
+			if tt.expectedKind != "" {
+				assert.Nil(t, tokenData)
+				assert.Equal(t, tt.expectedKind, err.(blperr.StackError).Kind(), err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, tokenData)
+		})
+	}
+}
+
+func TestClient_AuthenticateRoleOptions(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client, err := NewClientWithOptions("secret",
+		WithIssuerURL(issuer.server.URL),
+		WithAudiences("https://api.yourloops.com"),
+		WithHTTPClient(issuer.server.Client()),
+		WithRoleClaim("https://example.com/role"),
+		WithDefaultRole("patient"),
+	)
+	assert.Nil(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.sign(t, issuer.key, map[string]interface{}{"https://example.com/role": "hcp"}))
+	tokenData, err := client.AuthenticateWithError(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "hcp", tokenData.Role)
+
+	// the default role claim is ignored
+	req.Header.Set("Authorization", "Bearer "+issuer.sign(t, issuer.key, nil))
+	tokenData, err = client.AuthenticateWithError(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "patient", tokenData.Role)
+}
+
+func TestClient_AuthenticateWithClaims(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := issuer.newClient(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Authorization", "Bearer "+issuer.sign(t, issuer.key, map[string]interface{}{
+		"aud":            []string{"https://api.yourloops.com", "https://yourloops.eu.auth0.com/userinfo"},
+		"scope":          "openid read:data  write:data",
+		"email_verified": true,
+	}))
+	tokenData, claims, err := client.AuthenticateWithClaims(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "123456789", tokenData.UserId)
+	assert.Equal(t, &Claims{
+		Subject:       "auth0|123456789",
+		Issuer:        issuer.url(),
+		Audience:      []string{"https://api.yourloops.com", "https://yourloops.eu.auth0.com/userinfo"},
+		Scopes:        []string{"openid", "read:data", "write:data"},
+		EmailVerified: true,
+	}, claims)
+	assert.True(t, claims.HasScopes("read:data", "write:data"))
+	assert.False(t, claims.HasScopes("read:data", "delete:data"))
+	assert.True(t, claims.HasAudience("https://api.yourloops.com"))
+
+	req = httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("x-tidepool-session-token", sessionToken(t, "secret", 3600))
+	tokenData, claims, err = client.AuthenticateWithClaims(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "00004", tokenData.UserId)
+	assert.Nil(t, claims)
+	assert.False(t, claims.HasScopes("read:data"))
+	assert.False(t, claims.HasAudience("https://api.yourloops.com"))
+}
+
+func TestClient_VerifiedEmailRequired(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client, err := NewClientWithOptions("secret",
+		WithIssuerURL(issuer.server.URL),
+		WithAudiences("https://api.yourloops.com"),
+		WithHTTPClient(issuer.server.Client()),
+		WithVerifiedEmailRequired(true),
+	)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name         string
+		claims       map[string]interface{}
+		expectedKind string
+	}{
+		{name: "verified email", claims: map[string]interface{}{"email_verified": true}},
+		{name: "not verified email", claims: map[string]interface{}{"email_verified": false}, expectedKind: KindInvalidClaims},
+		{name: "no email_verified claim", claims: nil, expectedKind: KindInvalidClaims},
+		{name: "machine to machine token", claims: map[string]interface{}{"sub": "AbCdEf123@clients", "gty": "client-credentials"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data", nil)
+			req.Header.Set("Authorization", "Bearer "+issuer.sign(t, issuer.key, tt.claims))
+			_, err := client.AuthenticateWithError(req)
+			if tt.expectedKind == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.Equal(t, tt.expectedKind, err.(blperr.StackError).Kind(), err)
+		})
+	}
+}
@@ -4,130 +4,381 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
 	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/internal/lru"
 	"github.com/mdblp/shoreline/token"
 )
 
 // ClientInterface interface that we will implement and mock
 type ClientInterface interface {
 	Authenticate(req *http.Request) *token.TokenData
+	AuthenticateWithError(req *http.Request) (*token.TokenData, error)
+}
+
+// ClaimsAuthenticator is implemented by the clients which expose the claims of the bearer tokens (Client, ClientMock),
+// the Middleware uses it when available
+type ClaimsAuthenticator interface {
+	AuthenticateWithClaims(req *http.Request) (*token.TokenData, *Claims, error)
 }
 
 // Client holds the state of the Auth Client
 type Client struct {
-	authSecret     string
-	tokenValidator *validator.Validator
+	authSecret string
+	// validators of the bearer tokens, by issuer url
+	issuers    map[string]issuerValidators
+	algorithms []validator.SignatureAlgorithm
+	// claim holding the roles of the user, and role used when the token has none
+	roleClaim   string
+	defaultRole string
+	// revocationChecker and decisions (the decision cache) are optional
+	revocationChecker RevocationChecker
+	decisions         *lru.Cache[decisionKey, decision]
 }
 
+// issuerValidators are the validators of the tokens of an issuer, by signature algorithm
+type issuerValidators map[validator.SignatureAlgorithm]*validator.Validator
+
+var (
+	errEmailNotVerified = errors.New("the email of the user is not verified")
+	errUnknownIssuer    = errors.New("the issuer is not trusted")
+)
+
 // CustomClaims contains custom data we want from the token.
 type CustomClaims struct {
-	Scope    string   `json:"scope"`
-	Roles    []string `json:"http://your-loops.com/roles"`
-	IsServer bool     `json:"isServer"`
+	Scope    string `json:"scope"`
+	Roles    Roles  `json:"http://your-loops.com/roles"`
+	IsServer bool   `json:"isServer"`
+	// GrantType is set by Auth0 to "client-credentials" in the machine to machine tokens
+	GrantType     string `json:"gty"`
+	EmailVerified bool   `json:"email_verified"`
+	// requireVerifiedEmail is set from the client options, see WithVerifiedEmailRequired
+	requireVerifiedEmail bool
 }
 
-// Nothing to validate for tidewhisperer, roles do not matter
-// TODO: should we check that the email is verified? info should be in the token
+// Roles of the user, decoded from either a string or an array of strings
+type Roles []string
+
+func (r *Roles) UnmarshalJSON(data []byte) error {
+	var role string
+	if err := json.Unmarshal(data, &role); err == nil {
+		*r = Roles{role}
+		return nil
+	}
+	var roles []string
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return err
+	}
+	*r = roles
+	return nil
+}
+
+// Scopes returns the space separated scopes of the scope claim
+func (c CustomClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// Validate rejects the user tokens whose email is not verified when the client requires it,
+// machine to machine tokens have no email and are not checked. Roles do not matter.
 func (c CustomClaims) Validate(ctx context.Context) error {
+	if c.requireVerifiedEmail && !c.EmailVerified && c.GrantType != clientCredentialsGrantType {
+		return errEmailNotVerified
+	}
 	return nil
 }
 
 // WithCustomCa is a Provider Option for our jwks CachingProvider
 // It is used to specify a local CA cert, usefull when using a local OAuth server which use a self-signed cert
 func WithCustomCA(pem string) jwks.ProviderOption {
+	tr := customCATransport(pem)
+
+	return func(p *jwks.Provider) {
+		p.Client.Transport = tr
+	}
+}
+
+// customCATransport returns an http transport which trusts the CA cert given as pem
+func customCATransport(pem string) *http.Transport {
 	certPool := x509.NewCertPool()
 	certPool.AppendCertsFromPEM([]byte(pem))
 
-	tr := &http.Transport{
+	return &http.Transport{
 		TLSClientConfig: &tls.Config{
 			RootCAs: certPool,
 		},
 	}
-
-	return func(p *jwks.Provider) {
-		p.Client.Transport = tr
-	}
 }
 
-func setupAuth0() *validator.Validator {
+// envOptions reads the Auth0 configuration from the environment
+//
+// AUTH0_URL for the issuer
+//
+// AUTH0_ADDITIONAL_URLS, optional, for a comma separated list of other trusted issuers sharing the same audience
+//
+// AUTH0_AUDIENCE for the audience of the tokens
+//
+// SSL_CUSTOM_CA_KEY for a custom CA cert, used to fetch the JWKS
+func envOptions() []ClientOption {
 	//target audience is used to verify the token was issued for a specific domain or url.
 	//by default it will be empty but we would (in the future) use this to authorize or deny access to some urls
-	targetAudience := []string{}
+	opts := []ClientOption{WithIssuerURL(os.Getenv("AUTH0_URL"))}
 	if value, present := os.LookupEnv("AUTH0_AUDIENCE"); present {
-		targetAudience = []string{value}
+		opts = append(opts, WithAudiences(value))
 	}
-	issuerURL, err := url.Parse(os.Getenv("AUTH0_URL") + "/")
-	if err != nil {
-		log.Fatalf("Failed to parse the issuer url: %v", err)
+	for _, issuer := range strings.Split(os.Getenv("AUTH0_ADDITIONAL_URLS"), ",") {
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			opts = append(opts, WithIssuers(IssuerConfig{URL: issuer}))
+		}
 	}
-	keyProvider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
 	// Use a custom CA cert if it's provided
 	if os.Getenv("SSL_CUSTOM_CA_KEY") != "" {
-		keyProvider = jwks.NewCachingProvider(issuerURL, 5*time.Minute, WithCustomCA(os.Getenv("SSL_CUSTOM_CA_KEY")))
-	}
-	jwtValidator, err := validator.New(
-		keyProvider.KeyFunc,
-		validator.RS256,
-		issuerURL.String(),
-		targetAudience,
-		validator.WithCustomClaims(
-			func() validator.CustomClaims {
-				return &CustomClaims{}
-			},
-		),
-		validator.WithAllowedClockSkew(time.Minute),
-	)
-	if err != nil {
-		log.Fatalf("Failed to set up the jwt validator")
+		opts = append(opts, WithHTTPClient(&http.Client{Transport: customCATransport(os.Getenv("SSL_CUSTOM_CA_KEY"))}))
 	}
-
-	return jwtValidator
+	return opts
 }
 
-// NewClient creates a new Auth Client
+// NewClient creates a new Auth Client, configured with the AUTH0_URL, AUTH0_ADDITIONAL_URLS, AUTH0_AUDIENCE
+// and SSL_CUSTOM_CA_KEY environment variables
 func NewClient(authSecret string) (*Client, error) {
+	return NewClientWithOptions(authSecret, envOptions()...)
+}
 
-	validator := setupAuth0()
-
+// NewClientWithOptions creates a new Auth Client
+//
+// authSecret is the secret used to verify the legacy (shoreline) session tokens,
+// the options configure the validation of the OAuth bearer tokens. At least one issuer with an audience is required:
+// the one set with WithIssuerURL and WithAudiences, or the ones added with WithIssuers.
+func NewClientWithOptions(authSecret string, opts ...ClientOption) (*Client, error) {
+	options := defaultClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	issuers, err := newIssuers(options)
+	if err != nil {
+		return nil, err
+	}
 	return &Client{
-		authSecret:     authSecret,
-		tokenValidator: validator,
+		authSecret:        authSecret,
+		issuers:           issuers,
+		algorithms:        options.algorithms,
+		roleClaim:         options.roleClaim,
+		defaultRole:       options.defaultRole,
+		revocationChecker: options.revocationChecker,
+		decisions:         newDecisionCache(options.decisionCacheSize),
 	}, nil
 }
 
+// newIssuers creates the validators of each trusted issuer, by issuer url
+func newIssuers(options *clientOptions) (map[string]issuerValidators, error) {
+	if len(options.algorithms) == 0 {
+		return nil, errors.New("at least one signature algorithm is required")
+	}
+	configs := options.issuers
+	if options.issuerURL != "" {
+		primary := IssuerConfig{URL: options.issuerURL, Audiences: options.audiences, KeySet: options.keySet, KeySetFile: options.keySetFile}
+		configs = append([]IssuerConfig{primary}, configs...)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("the issuer url is required")
+	}
+	issuers := make(map[string]issuerValidators, len(configs))
+	for _, config := range configs {
+		if config.URL == "" {
+			return nil, errors.New("the issuer url is required")
+		}
+		if len(config.Audiences) == 0 {
+			// additional issuers default to the audiences of the primary one, the api does not change with the tenant
+			config.Audiences = options.audiences
+		}
+		validators, err := newValidators(config, options)
+		if err != nil {
+			return nil, err
+		}
+		issuers[normalizeIssuer(config.URL)] = validators
+	}
+	return issuers, nil
+}
+
+// normalizeIssuer adds a trailing slash to an issuer url, as Auth0 issues them
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(issuer, "/") + "/"
+}
+
+// newValidators creates a jwt validator of an issuer for each allowed algorithm, sharing the same keys
+func newValidators(config IssuerConfig, options *clientOptions) (issuerValidators, error) {
+	issuerURL, err := url.Parse(normalizeIssuer(config.URL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the issuer url: %w", err)
+	}
+	if len(config.Audiences) == 0 {
+		return nil, fmt.Errorf("at least one audience is required for issuer [%s]", issuerURL)
+	}
+	keyFunc, err := options.keyFunc(issuerURL, config.KeySet, config.KeySetFile)
+	if err != nil {
+		return nil, err
+	}
+
+	validators := make(issuerValidators, len(options.algorithms))
+	for _, algorithm := range options.algorithms {
+		jwtValidator, err := validator.New(
+			keyFunc,
+			algorithm,
+			issuerURL.String(),
+			config.Audiences,
+			validator.WithCustomClaims(
+				func() validator.CustomClaims {
+					return &CustomClaims{requireVerifiedEmail: options.requireVerifiedEmail}
+				},
+			),
+			validator.WithAllowedClockSkew(options.clockSkew),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up the jwt validator: %w", err)
+		}
+		validators[algorithm] = jwtValidator
+	}
+	return validators, nil
+}
+
+// validateToken validates a bearer token with the validator matching its issuer and signature algorithm.
+// Both are read from the token before its verification, so the tokens of unknown issuers never trigger a JWKS fetch.
+func (client *Client) validateToken(ctx context.Context, rawToken string) (*validator.ValidatedClaims, error) {
+	algorithm, err := jwtAlgorithm(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(client.algorithms, validator.SignatureAlgorithm(algorithm)) {
+		return nil, fmt.Errorf("signature algorithm [%s] is not allowed", algorithm)
+	}
+	issuer, err := jwtIssuer(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	validators, ok := client.issuers[normalizeIssuer(issuer)]
+	if !ok {
+		return nil, fmt.Errorf("%w: [%s]", errUnknownIssuer, issuer)
+	}
+	claims, err := validators[validator.SignatureAlgorithm(algorithm)].ValidateToken(ctx, rawToken)
+	if err != nil {
+		return nil, err
+	}
+	return claims.(*validator.ValidatedClaims), nil
+}
+
 // Authenticate the incomming request using either the x-tidepool-session token or the authorization Bearer token provided by OAuth
 func (client *Client) Authenticate(req *http.Request) *token.TokenData {
-	if sessionToken := req.Header.Get("x-tidepool-session-token"); sessionToken != "" {
-		tokenData, err := token.UnpackSessionTokenAndVerify(sessionToken, client.authSecret)
+	tokenData, err := client.AuthenticateWithError(req)
+	var stackErr blperr.StackError
+	switch {
+	case err == nil:
+	case errors.As(err, &stackErr):
+		log.Printf("%s: %s %v", stackErr.Kind(), stackErr.Message(), stackErr.Details())
+	default:
+		log.Print(err)
+	}
+	return tokenData
+}
+
+// AuthenticateWithError authenticates the incomming request like Authenticate, but returns the reason of the failure:
+// a blperr.StackError whose kind tells why the request is rejected (KindMissingToken, KindExpiredToken...).
+// Use HTTPStatus and WWWAuthenticate to build the response.
+func (client *Client) AuthenticateWithError(req *http.Request) (*token.TokenData, error) {
+	tokenData, _, err := client.AuthenticateWithClaims(req)
+	return tokenData, err
+}
+
+// AuthenticateWithClaims authenticates the incomming request like AuthenticateWithError, and returns the claims
+// of the bearer token which are not part of the token data (scopes, audience...).
+// The claims are nil when the request is authenticated with a legacy session token.
+func (client *Client) AuthenticateWithClaims(req *http.Request) (*token.TokenData, *Claims, error) {
+	var sessionErr error
+	if sessionToken := req.Header.Get(token.TP_SESSION_TOKEN); sessionToken != "" {
+		tokenData, err := client.authenticateSessionToken(sessionToken)
 		//More validations?
-		if err != nil {
-			log.Print("Error decoding tidepool session token")
-		} else {
-			return tokenData
+		if err == nil {
+			return tokenData, nil, nil
 		}
-
+		sessionErr = sessionTokenError(err)
 	}
 	// Defaults to the auth bearer token when the tidepool token is not provided or invalid
-	var parsedToken *validator.ValidatedClaims
-	if rawToken, err := jwtmiddleware.AuthHeaderTokenExtractor(req); err != nil {
-		log.Print("Error decoding bearer token")
-		return nil
-	} else if t, err := client.tokenValidator.ValidateToken(req.Context(), rawToken); err != nil {
-		log.Print("Error decoding bearer token")
+	rawToken, err := jwtmiddleware.AuthHeaderTokenExtractor(req)
+	if err != nil {
+		return nil, nil, newAuthError(KindMalformedToken, err)
+	}
+	if rawToken == "" {
+		if sessionErr != nil {
+			return nil, nil, sessionErr
+		}
+		return nil, nil, newAuthError(KindMissingToken, nil)
+	}
+	return client.authenticateBearerToken(req.Context(), rawToken)
+}
+
+func (client *Client) authenticateSessionToken(sessionToken string) (*token.TokenData, error) {
+	key := newDecisionKey(token.TP_SESSION_TOKEN, sessionToken)
+	if cached, ok := client.cachedDecision(key); ok {
+		return cached.tokenData, nil
+	}
+	tokenData, err := token.UnpackSessionTokenAndVerify(sessionToken, client.authSecret)
+	if err != nil {
+		return nil, err
+	}
+	client.cacheDecision(key, sessionToken, decision{tokenData: tokenData})
+	return tokenData, nil
+}
+
+func (client *Client) authenticateBearerToken(ctx context.Context, rawToken string) (*token.TokenData, *Claims, error) {
+	key := newDecisionKey("Authorization", rawToken)
+	if cached, ok := client.cachedDecision(key); ok {
+		// a cached token may have been revoked since
+		if err := client.checkRevocation(ctx, cached.registeredClaims); err != nil {
+			return nil, nil, err
+		}
+		return cached.tokenData, cached.claims, nil
+	}
+	parsedToken, err := client.validateToken(ctx, rawToken)
+	if err != nil {
+		return nil, nil, bearerTokenError(err)
+	}
+	if err := client.checkRevocation(ctx, parsedToken.RegisteredClaims); err != nil {
+		return nil, nil, err
+	}
+	tokenData, claims, err := client.tokenData(parsedToken, rawToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.cacheDecision(key, rawToken, decision{tokenData: tokenData, claims: claims, registeredClaims: parsedToken.RegisteredClaims})
+	return tokenData, claims, nil
+}
+
+// checkRevocation rejects the revoked tokens, and the tokens which cannot be checked
+func (client *Client) checkRevocation(ctx context.Context, claims validator.RegisteredClaims) error {
+	if client.revocationChecker == nil {
 		return nil
-	} else {
-		parsedToken = t.(*validator.ValidatedClaims)
 	}
-	uid := strings.Split(parsedToken.RegisteredClaims.Subject, "|")[1]
-	customClaims := parsedToken.CustomClaims.(*CustomClaims)
-	return &token.TokenData{UserId: uid, IsServer: customClaims.IsServer, Role: customClaims.Roles[0]}
+	identity := TokenIdentity{ID: claims.ID, Subject: claims.Subject}
+	if claims.IssuedAt != 0 {
+		identity.IssuedAt = time.Unix(claims.IssuedAt, 0)
+	}
+	revoked, err := client.revocationChecker.IsRevoked(ctx, identity)
+	if err != nil {
+		return newAuthError(KindInvalidToken, fmt.Errorf("failed to check the revocation of the token: %w", err))
+	}
+	if revoked {
+		return newAuthError(KindRevokedToken, nil)
+	}
+	return nil
 }
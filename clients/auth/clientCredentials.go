@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdblp/go-common/v2/http/request"
+)
+
+const (
+	defaultRefreshBefore = time.Minute
+	defaultFetchTimeout  = 30 * time.Second
+	defaultRetryBackoff  = 5 * time.Second
+	// a token is not used anymore when it expires in less than expiryLeeway
+	expiryLeeway = 10 * time.Second
+)
+
+// ClientCredentialsConfig holds the settings of a ClientCredentialsProvider
+type ClientCredentialsConfig struct {
+	// TokenURL is the OAuth token endpoint, for example https://yourloops.eu.auth0.com/oauth/token
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Audience of the requested tokens (the api identifier in Auth0)
+	Audience string
+	// Scope is optional, a space separated list of scopes
+	Scope string
+	// RefreshBefore is the duration before the expiration of the token from which a new one is fetched in background.
+	// Defaults to 1 minute.
+	RefreshBefore time.Duration
+	// FetchTimeout bounds the duration of a call to the token endpoint. Defaults to 30 seconds.
+	FetchTimeout time.Duration
+	// RetryBackoff is the duration during which the token endpoint is not called again after a failed call,
+	// the error of the failed call is returned meanwhile. Defaults to 5 seconds.
+	RetryBackoff time.Duration
+	// HTTPClient used to call the token endpoint, defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// ClientCredentialsProvider is a clients.RefreshableTokenProvider which gets machine to machine tokens
+// from an OAuth token endpoint (Auth0 /oauth/token) with the client credentials grant.
+//
+// Tokens are cached until shortly before they expire. When a token is about to expire, a new one is fetched
+// in background while the current one is still returned. Concurrent callers share a single call to the token endpoint.
+type ClientCredentialsProvider struct {
+	config    ClientCredentialsConfig
+	now       func() time.Time
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	inflight  *tokenFetch
+	// failure is the error of the last call to the token endpoint, made at failedAt, nil when it succeeded
+	failure  error
+	failedAt time.Time
+}
+
+// tokenFetch is a call to the token endpoint shared by all the callers waiting for a token
+type tokenFetch struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// NewClientCredentialsProvider creates a ClientCredentialsProvider, no token is fetched before the first call
+func NewClientCredentialsProvider(config ClientCredentialsConfig) (*ClientCredentialsProvider, error) {
+	if config.TokenURL == "" {
+		return nil, errors.New("token url is empty")
+	}
+	if _, err := url.Parse(config.TokenURL); err != nil {
+		return nil, errors.New("invalid token url")
+	}
+	if config.ClientID == "" || config.ClientSecret == "" {
+		return nil, errors.New("client id and client secret are required")
+	}
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = defaultRefreshBefore
+	}
+	if config.FetchTimeout <= 0 {
+		config.FetchTimeout = defaultFetchTimeout
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = defaultRetryBackoff
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	return &ClientCredentialsProvider{config: config, now: time.Now}, nil
+}
+
+// NewClientCredentialsProviderFromEnv creates a ClientCredentialsProvider using environment variables
+//
+// AUTH0_URL for the issuer, tokens are requested to AUTH0_URL/oauth/token
+//
+// AUTH0_AUDIENCE for the audience of the tokens
+//
+// AUTH0_CLIENT_ID and AUTH0_CLIENT_SECRET for the client credentials
+//
+// SSL_CUSTOM_CA_KEY for a custom CA cert, used when httpClient is nil
+func NewClientCredentialsProviderFromEnv(httpClient *http.Client) (*ClientCredentialsProvider, error) {
+	issuer, present := os.LookupEnv("AUTH0_URL")
+	if !present {
+		return nil, errors.New("Missing AUTH0_URL environnement variable")
+	}
+	if httpClient == nil && os.Getenv("SSL_CUSTOM_CA_KEY") != "" {
+		httpClient = &http.Client{Transport: customCATransport(os.Getenv("SSL_CUSTOM_CA_KEY"))}
+	}
+	return NewClientCredentialsProvider(ClientCredentialsConfig{
+		TokenURL:     strings.TrimSuffix(issuer, "/") + "/oauth/token",
+		ClientID:     os.Getenv("AUTH0_CLIENT_ID"),
+		ClientSecret: os.Getenv("AUTH0_CLIENT_SECRET"),
+		Audience:     os.Getenv("AUTH0_AUDIENCE"),
+		HTTPClient:   httpClient,
+	})
+}
+
+// Token returns a valid token, fetching a new one when the cached token is missing or expired.
+// After a failed call to the token endpoint, it is not called again before RetryBackoff.
+func (p *ClientCredentialsProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	now := p.now()
+	backingOff := p.failure != nil && now.Before(p.failedAt.Add(p.config.RetryBackoff))
+	if p.token != "" && now.Before(p.expiresAt.Add(-expiryLeeway)) {
+		token := p.token
+		if now.After(p.expiresAt.Add(-p.config.RefreshBefore)) && !backingOff {
+			// proactive refresh, the current token is still valid
+			p.startFetch()
+		}
+		p.mu.Unlock()
+		return token, nil
+	}
+	if backingOff {
+		err := p.failure
+		p.mu.Unlock()
+		return "", err
+	}
+	fetch := p.startFetch()
+	p.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+		return fetch.token, fetch.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// TokenProvide implements clients.TokenProvider, it returns an empty string when no token can be fetched
+func (p *ClientCredentialsProvider) TokenProvide() string {
+	token, err := p.Token(context.Background())
+	if err != nil {
+		log.Printf("Failed to get a machine to machine token: %v", err)
+	}
+	return token
+}
+
+// RefreshToken implements clients.RefreshableTokenProvider, it discards the cached token and fetches a new one
+func (p *ClientCredentialsProvider) RefreshToken() string {
+	p.mu.Lock()
+	p.token = ""
+	p.mu.Unlock()
+	return p.TokenProvide()
+}
+
+// startFetch starts a call to the token endpoint, unless one is already in flight. p.mu must be held.
+func (p *ClientCredentialsProvider) startFetch() *tokenFetch {
+	if p.inflight != nil {
+		return p.inflight
+	}
+	fetch := &tokenFetch{done: make(chan struct{})}
+	p.inflight = fetch
+	go func() {
+		// the call is not bound to the context of a caller, as its result is shared
+		ctx, cancel := context.WithTimeout(context.Background(), p.config.FetchTimeout)
+		defer cancel()
+		token, expiresAt, err := p.fetchToken(ctx)
+
+		p.mu.Lock()
+		if err == nil {
+			p.token = token
+			p.expiresAt = expiresAt
+			p.failure = nil
+		} else {
+			p.failure = err
+			p.failedAt = p.now()
+		}
+		p.inflight = nil
+		p.mu.Unlock()
+
+		fetch.token, fetch.err = token, err
+		close(fetch.done)
+	}()
+	return fetch
+}
+
+func (p *ClientCredentialsProvider) fetchToken(ctx context.Context) (string, time.Time, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+	}
+	if p.config.Audience != "" {
+		form.Set("audience", p.config.Audience)
+	}
+	if p.config.Scope != "" {
+		form.Set("scope", p.config.Scope)
+	}
+	var response tokenResponse
+	_, err := request.NewPostBuilder(p.config.TokenURL).
+		WithFormPayload(form).
+		WithAccept("application/json").
+		Do(ctx, p.config.HTTPClient, &response)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if response.AccessToken == "" {
+		return "", time.Time{}, errors.New("no access token in the token endpoint response")
+	}
+
+	now := p.now()
+	expiresAt := now.Add(time.Duration(response.ExpiresIn) * time.Second)
+	if response.ExpiresIn <= 0 {
+		exp, ok := jwtExpiry(response.AccessToken)
+		if !ok {
+			return "", time.Time{}, errors.New("unable to find the expiration of the access token")
+		}
+		expiresAt = exp
+	}
+	return response.AccessToken, expiresAt, nil
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mdblp/go-common/v2/clients"
+)
+
+// newTokenServer starts a fake Auth0 token endpoint, it issues token-1, token-2... valid for expiresIn seconds
+func newTokenServer(t *testing.T, expiresIn int, delay time.Duration) (*httptest.Server, *int32) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/oauth/token" || req.Method != http.MethodPost {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = req.ParseForm()
+		assert.Equal(t, "client_credentials", req.PostForm.Get("grant_type"))
+		if req.PostForm.Get("client_id") != "clientId" || req.PostForm.Get("client_secret") != "clientSecret" {
+			res.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(res, `{"error":"access_denied","error_description":"Unauthorized"}`)
+			return
+		}
+		assert.Equal(t, "https://api.yourloops.com", req.PostForm.Get("audience"))
+		time.Sleep(delay)
+		token := atomic.AddInt32(&issued, 1)
+		res.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(res, `{"access_token":"token-%d","expires_in":%d,"token_type":"Bearer"}`, token, expiresIn)
+	}))
+	return server, &issued
+}
+
+func newTestProvider(t *testing.T, server *httptest.Server) *ClientCredentialsProvider {
+	provider, err := NewClientCredentialsProvider(ClientCredentialsConfig{
+		TokenURL:     server.URL + "/oauth/token",
+		ClientID:     "clientId",
+		ClientSecret: "clientSecret",
+		Audience:     "https://api.yourloops.com",
+		HTTPClient:   server.Client(),
+	})
+	assert.Nil(t, err)
+	return provider
+}
+
+func TestClientCredentialsProvider_Token(t *testing.T) {
+	t.Run("Caches the token until it is about to expire", func(t *testing.T) {
+		server, issued := newTokenServer(t, 3600, 0)
+		defer server.Close()
+		provider := newTestProvider(t, server)
+		now := time.Now()
+		provider.now = func() time.Time { return now }
+
+		token, err := provider.Token(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, "token-1", token)
+		token, _ = provider.Token(context.TODO())
+		assert.Equal(t, "token-1", token)
+		assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+
+		// after expiration, the next call waits for a new token
+		now = now.Add(time.Hour)
+		token, _ = provider.Token(context.TODO())
+		assert.Equal(t, "token-2", token)
+	})
+	t.Run("Refreshes the token in background before it expires", func(t *testing.T) {
+		server, issued := newTokenServer(t, 3600, 0)
+		defer server.Close()
+		provider := newTestProvider(t, server)
+		var mu sync.Mutex
+		now := time.Now()
+		provider.now = func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}
+		token, _ := provider.Token(context.TODO())
+		assert.Equal(t, "token-1", token)
+
+		mu.Lock()
+		now = now.Add(time.Hour - 30*time.Second)
+		mu.Unlock()
+		token, _ = provider.Token(context.TODO())
+		assert.Equal(t, "token-1", token)
+		assert.Eventually(t, func() bool {
+			token, _ := provider.Token(context.TODO())
+			return token == "token-2"
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, int32(2), atomic.LoadInt32(issued))
+	})
+	t.Run("Fetches a single token for concurrent callers", func(t *testing.T) {
+		server, issued := newTokenServer(t, 3600, 50*time.Millisecond)
+		defer server.Close()
+		provider := newTestProvider(t, server)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				token, err := provider.Token(context.TODO())
+				assert.Nil(t, err)
+				assert.Equal(t, "token-1", token)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(issued))
+	})
+	t.Run("Uses the exp claim when expires_in is missing", func(t *testing.T) {
+		exp := time.Now().Add(time.Hour).Unix()
+		payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp)))
+		jwt := "eyJhbGciOiJSUzI1NiJ9." + payload + ".signature"
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(res, `{"access_token":"%s","token_type":"Bearer"}`, jwt)
+		}))
+		defer server.Close()
+		provider := newTestProvider(t, server)
+		token, err := provider.Token(context.TODO())
+		assert.Nil(t, err)
+		assert.Equal(t, jwt, token)
+		assert.Equal(t, exp, provider.expiresAt.Unix())
+	})
+	t.Run("Returns the token endpoint error", func(t *testing.T) {
+		server, _ := newTokenServer(t, 3600, 0)
+		defer server.Close()
+		provider, _ := NewClientCredentialsProvider(ClientCredentialsConfig{
+			TokenURL:     server.URL + "/oauth/token",
+			ClientID:     "clientId",
+			ClientSecret: "wrongSecret",
+			HTTPClient:   server.Client(),
+		})
+		token, err := provider.Token(context.TODO())
+		assert.NotNil(t, err)
+		assert.Equal(t, "", token)
+		assert.Equal(t, "", provider.TokenProvide())
+	})
+	t.Run("Honours the caller context", func(t *testing.T) {
+		server, _ := newTokenServer(t, 3600, 200*time.Millisecond)
+		defer server.Close()
+		provider := newTestProvider(t, server)
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		_, err := provider.Token(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestClientCredentialsProvider_RetryBackoff(t *testing.T) {
+	var calls int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		call := atomic.AddInt32(&calls, 1)
+		if failing.Load() {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(res, `{"access_token":"token-%d","expires_in":3600,"token_type":"Bearer"}`, call)
+	}))
+	defer server.Close()
+	provider := newTestProvider(t, server)
+	var mu sync.Mutex
+	now := time.Now()
+	provider.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	failing.Store(true)
+	_, err := provider.Token(context.TODO())
+	assert.NotNil(t, err)
+	for i := 0; i < 5; i++ {
+		_, retryErr := provider.Token(context.TODO())
+		assert.Equal(t, err, retryErr)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// the token endpoint is called again after the backoff
+	failing.Store(false)
+	advance(defaultRetryBackoff)
+	token, err := provider.Token(context.TODO())
+	assert.Nil(t, err)
+	assert.Equal(t, "token-2", token)
+
+	// a failed proactive refresh is not retried before the backoff, the current token is returned meanwhile
+	failing.Store(true)
+	advance(time.Hour - 30*time.Second)
+	_, _ = provider.Token(context.TODO())
+	assert.Eventually(t, func() bool {
+		provider.mu.Lock()
+		defer provider.mu.Unlock()
+		return provider.failure != nil
+	}, time.Second, 5*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		token, _ = provider.Token(context.TODO())
+		assert.Equal(t, "token-2", token)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestClientCredentialsProvider_RefreshToken(t *testing.T) {
+	server, _ := newTokenServer(t, 3600, 0)
+	defer server.Close()
+	var provider clients.RefreshableTokenProvider = newTestProvider(t, server)
+	assert.Equal(t, "token-1", provider.TokenProvide())
+	assert.Equal(t, "token-2", provider.RefreshToken())
+	assert.Equal(t, "token-2", provider.TokenProvide())
+}
+
+func TestNewClientCredentialsProviderFromEnv(t *testing.T) {
+	server, _ := newTokenServer(t, 3600, 0)
+	defer server.Close()
+	t.Setenv("AUTH0_URL", server.URL)
+	t.Setenv("AUTH0_AUDIENCE", "https://api.yourloops.com")
+	t.Setenv("AUTH0_CLIENT_ID", "clientId")
+	t.Setenv("AUTH0_CLIENT_SECRET", "clientSecret")
+	provider, err := NewClientCredentialsProviderFromEnv(server.Client())
+	assert.Nil(t, err)
+	assert.Equal(t, "token-1", provider.TokenProvide())
+}
+
+func TestNewClientCredentialsProvider_Errors(t *testing.T) {
+	_, err := NewClientCredentialsProvider(ClientCredentialsConfig{ClientID: "id", ClientSecret: "secret"})
+	assert.NotNil(t, err)
+	_, err = NewClientCredentialsProvider(ClientCredentialsConfig{TokenURL: "http://auth/oauth/token"})
+	assert.NotNil(t, err)
+}
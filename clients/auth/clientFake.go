@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/mdblp/shoreline/token"
+)
+
+const (
+	fakeIssuer   = "https://fake.yourloops.com/"
+	fakeAudience = "https://api.yourloops.com"
+	fakeSecret   = "fake-session-secret"
+)
+
+// FakeUser is the user on behalf of whom a FakeClient authenticates a request
+type FakeUser struct {
+	UserID string
+	Role   string
+	// IsServer sends a server token: a machine to machine bearer token whose client id is UserID,
+	// or a shoreline server token with Session
+	IsServer bool
+	// Session sends a legacy session token instead of a bearer token
+	Session bool
+}
+
+// FakeClient is a real auth client, which trusts the tokens it mints for its users. Unlike ClientMock, the handlers under test
+// go through the parsing of the authentication headers:
+//
+//	fake := auth.NewFake(auth.FakeUser{UserID: "123456789", Role: "hcp"}, auth.FakeUser{UserID: "AbCd", IsServer: true})
+//	handler := auth.NewMiddleware(fake).Handler(dataHandler)
+//	handler.ServeHTTP(res, fake.Request(http.MethodGet, "/data", "123456789"))
+type FakeClient struct {
+	*Client
+	signer *TokenSigner
+	users  map[string]FakeUser
+}
+
+// NewFake creates a FakeClient configured with its users, it panics when the signing key cannot be generated
+func NewFake(users ...FakeUser) *FakeClient {
+	return NewFakeWithOptions(users)
+}
+
+// NewFakeWithOptions creates a FakeClient configured with its users and the options of the underlying client
+// (WithRevocationChecker, WithVerifiedEmailRequired...), it panics when the signing key cannot be generated
+func NewFakeWithOptions(users []FakeUser, opts ...ClientOption) *FakeClient {
+	signer, err := NewTokenSigner(fakeIssuer, fakeAudience)
+	if err != nil {
+		panic(err)
+	}
+	client, err := NewClientWithOptions(fakeSecret, append(signer.ClientOptions(), opts...)...)
+	if err != nil {
+		panic(err)
+	}
+	fake := &FakeClient{Client: client, signer: signer, users: make(map[string]FakeUser, len(users))}
+	for _, user := range users {
+		fake.users[user.UserID] = user
+	}
+	return fake
+}
+
+// User returns the configured user, it panics when the fake has no such user
+func (fake *FakeClient) User(userID string) FakeUser {
+	user, ok := fake.users[userID]
+	if !ok {
+		panic("auth: unknown fake user " + userID)
+	}
+	return user
+}
+
+// Signer returns the signer of the bearer tokens, to mint tokens with custom claims
+func (fake *FakeClient) Signer() *TokenSigner {
+	return fake.signer
+}
+
+// Token mints a token for the user, a bearer token or a session token (see FakeUser.Session).
+// The user does not need to be configured, to test unexpected identities.
+func (fake *FakeClient) Token(user FakeUser) string {
+	var rawToken string
+	var err error
+	switch {
+	case user.Session:
+		var sessionToken *token.SessionToken
+		sessionToken, err = token.CreateSessionToken(
+			&token.TokenData{UserId: user.UserID, Role: user.Role, IsServer: user.IsServer, DurationSecs: 3600},
+			token.TokenConfig{Secret: fakeSecret, DurationSecs: 3600},
+		)
+		if err == nil {
+			rawToken = sessionToken.ID
+		}
+	case user.IsServer:
+		claims := map[string]interface{}{"sub": user.UserID + clientSubjectSuffix, "gty": clientCredentialsGrantType}
+		if user.Role != "" {
+			claims[DefaultRoleClaim] = []string{user.Role}
+		}
+		rawToken, err = fake.signer.Sign(claims)
+	default:
+		rawToken, err = fake.signer.SignUser(user.UserID, user.Role)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return rawToken
+}
+
+// Authorize adds the authentication header of the user to a request
+func (fake *FakeClient) Authorize(req *http.Request, user FakeUser) *http.Request {
+	if user.Session {
+		req.Header.Set(token.TP_SESSION_TOKEN, fake.Token(user))
+	} else {
+		req.Header.Set("Authorization", "Bearer "+fake.Token(user))
+	}
+	return req
+}
+
+// Request creates a request authenticated with the token of a configured user (see User)
+func (fake *FakeClient) Request(method string, target string, userID string) *http.Request {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		panic(err)
+	}
+	return fake.Authorize(req, fake.User(userID))
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/go-common/v2/context"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClient(t *testing.T) {
+	fake := NewFake()
+	var _ ClientInterface = fake
+
+	tests := []struct {
+		name     string
+		user     FakeUser
+		expected *token.TokenData
+	}{
+		{name: "bearer token", user: FakeUser{UserID: "123", Role: "hcp"}, expected: &token.TokenData{UserId: "123", Role: "hcp"}},
+		{name: "session token", user: FakeUser{UserID: "456", Role: "patient", Session: true}, expected: &token.TokenData{UserId: "456", Role: "patient"}},
+		{name: "machine to machine token", user: FakeUser{UserID: "AbCd", IsServer: true}, expected: &token.TokenData{UserId: "AbCd", IsServer: true}},
+		{
+			name:     "server session token",
+			user:     FakeUser{UserID: "shoreline", IsServer: true, Session: true},
+			expected: &token.TokenData{UserId: "shoreline", IsServer: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := fake.Authorize(httptest.NewRequest(http.MethodGet, "/data", nil), tt.user)
+			tokenData, err := fake.AuthenticateWithError(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected.UserId, tokenData.UserId)
+			assert.Equal(t, tt.expected.Role, tokenData.Role)
+			assert.Equal(t, tt.expected.IsServer, tokenData.IsServer)
+		})
+	}
+}
+
+func TestFakeClient_WithMiddleware(t *testing.T) {
+	fake := NewFake(
+		FakeUser{UserID: "123", Role: "hcp"},
+		FakeUser{UserID: "456", Role: "patient", Session: true},
+		FakeUser{UserID: "AbCd", IsServer: true},
+	)
+	var userID string
+	handler := NewMiddleware(fake, RequireRole("hcp")).HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		userID, _ = context.GetUserId(req.Context())
+	})
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, fake.Request(http.MethodGet, "/data", "123"))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "123", userID)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, fake.Request(http.MethodGet, "/data", "456"))
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, fake.Request(http.MethodGet, "/data", "AbCd"))
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	// tokens of another fake are not trusted
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, NewFake(FakeUser{UserID: "123", Role: "hcp"}).Request(http.MethodGet, "/data", "123"))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestFakeClient_User(t *testing.T) {
+	fake := NewFakeWithOptions([]FakeUser{{UserID: "456", Role: "patient", Session: true}}, WithDefaultRole("patient"))
+	assert.Equal(t, FakeUser{UserID: "456", Role: "patient", Session: true}, fake.User("456"))
+	assert.Panics(t, func() { fake.Request(http.MethodGet, "/data", "unknown") })
+}
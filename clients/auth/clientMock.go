@@ -23,3 +23,24 @@ func (client *ClientMock) Authenticate(req *http.Request) *token.TokenData {
 		return args.Get(0).(*token.TokenData)
 	}
 }
+
+func (client *ClientMock) AuthenticateWithError(req *http.Request) (*token.TokenData, error) {
+	args := client.Called(req)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*token.TokenData), args.Error(1)
+}
+
+func (client *ClientMock) AuthenticateWithClaims(req *http.Request) (*token.TokenData, *Claims, error) {
+	args := client.Called(req)
+	var tokenData *token.TokenData
+	if args.Get(0) != nil {
+		tokenData = args.Get(0).(*token.TokenData)
+	}
+	var claims *Claims
+	if args.Get(1) != nil {
+		claims = args.Get(1).(*Claims)
+	}
+	return tokenData, claims, args.Error(2)
+}
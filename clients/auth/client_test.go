@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/go-jose/go-jose.v2"
+	josejwt "gopkg.in/go-jose/go-jose.v2/jwt"
+
+	"github.com/mdblp/go-common/v2/blperr"
+)
+
+func TestNewClientWithOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ClientOption
+		wantErr bool
+	}{
+		{
+			name: "valid configuration",
+			opts: []ClientOption{WithIssuerURL("https://yourloops.eu.auth0.com"), WithAudiences("https://api.yourloops.com")},
+		},
+		{
+			name: "full configuration",
+			opts: []ClientOption{
+				WithIssuerURL("https://yourloops.eu.auth0.com/"),
+				WithAudiences("https://api.yourloops.com", "https://admin.yourloops.com"),
+				WithAllowedAlgorithms(validator.RS256, validator.PS256),
+				WithClockSkew(30 * time.Second),
+				WithJWKSCacheTTL(time.Hour),
+				WithHTTPClient(&http.Client{Timeout: time.Second}),
+			},
+		},
+		{
+			name:    "missing issuer",
+			opts:    []ClientOption{WithAudiences("https://api.yourloops.com")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid issuer",
+			opts:    []ClientOption{WithIssuerURL(":not-an-url"), WithAudiences("https://api.yourloops.com")},
+			wantErr: true,
+		},
+		{
+			name:    "missing audience",
+			opts:    []ClientOption{WithIssuerURL("https://yourloops.eu.auth0.com")},
+			wantErr: true,
+		},
+		{
+			name:    "no algorithm",
+			opts:    []ClientOption{WithIssuerURL("https://yourloops.eu.auth0.com"), WithAudiences("api"), WithAllowedAlgorithms()},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			opts:    []ClientOption{WithIssuerURL("https://yourloops.eu.auth0.com"), WithAudiences("api"), WithAllowedAlgorithms("none")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithOptions("secret", tt.opts...)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantErr, client == nil)
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("Returns an error instead of exiting when the environment is incomplete", func(t *testing.T) {
+		t.Setenv("AUTH0_URL", "https://yourloops.eu.auth0.com")
+		client, err := NewClient("secret")
+		assert.NotNil(t, err)
+		assert.Nil(t, client)
+	})
+	t.Run("Creates the client from the environment", func(t *testing.T) {
+		t.Setenv("AUTH0_URL", "https://yourloops.eu.auth0.com")
+		t.Setenv("AUTH0_AUDIENCE", "https://api.yourloops.com")
+		client, err := NewClient("secret")
+		assert.Nil(t, err)
+		assert.Contains(t, client.issuers["https://yourloops.eu.auth0.com/"], validator.RS256)
+	})
+}
+
+func TestClient_validateTokenRejectsNotAllowedAlgorithms(t *testing.T) {
+	client, err := NewClientWithOptions("secret", WithIssuerURL("https://yourloops.eu.auth0.com"), WithAudiences("api"))
+	assert.Nil(t, err)
+	// {"alg":"HS256","typ":"JWT"}
+	_, err = client.validateToken(context.TODO(), "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9.eyJzdWIiOiIxMjM0In0.signature")
+	assert.EqualError(t, err, "signature algorithm [HS256] is not allowed")
+	_, err = client.validateToken(context.TODO(), "not-a-jwt")
+	assert.NotNil(t, err)
+}
+
+// testIssuer is a fake OAuth issuer serving its JWKS over http
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		switch req.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(res, `{"issuer":"%s/","jwks_uri":"%s/.well-known/jwks.json"}`, issuer.server.URL, issuer.server.URL)
+		case "/.well-known/jwks.json":
+			_ = json.NewEncoder(res).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+				{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"},
+			}})
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) url() string {
+	return i.server.URL + "/"
+}
+
+// sign mints a RS256 token, claims are added to default ones (iss, aud, sub, exp)
+func (i *testIssuer) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	allClaims := map[string]interface{}{
+		"iss":                         i.url(),
+		"aud":                         "https://api.yourloops.com",
+		"sub":                         "auth0|123456789",
+		"iat":                         time.Now().Unix(),
+		"exp":                         time.Now().Add(time.Hour).Unix(),
+		"http://your-loops.com/roles": []string{"hcp"},
+	}
+	for name, value := range claims {
+		allClaims[name] = value
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test-key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := josejwt.Signed(signer).Claims(allClaims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (i *testIssuer) newClient(t *testing.T) *Client {
+	client, err := NewClientWithOptions("secret",
+		WithIssuerURL(i.server.URL),
+		WithAudiences("https://api.yourloops.com"),
+		WithHTTPClient(i.server.Client()),
+		WithClockSkew(0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func sessionToken(t *testing.T, secret string, durationSecs int64) string {
+	sessionToken, err := token.CreateSessionToken(
+		&token.TokenData{UserId: "00004", Role: "patient", DurationSecs: durationSecs},
+		token.TokenConfig{Secret: secret, DurationSecs: 3600},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessionToken.ID
+}
+
+func TestClient_AuthenticateWithError(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := issuer.newClient(t)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	tests := []struct {
+		name          string
+		sessionToken  string
+		authorization string
+		expectedUser  string
+		expectedKind  string
+	}{
+		{name: "valid session token", sessionToken: sessionToken(t, "secret", 3600), expectedUser: "00004"},
+		{name: "valid bearer token", authorization: "Bearer " + issuer.sign(t, issuer.key, nil), expectedUser: "123456789"},
+		{name: "no token", expectedKind: KindMissingToken},
+		{name: "not a bearer authorization", authorization: "Basic dXNlcjpwYXNz", expectedKind: KindMalformedToken},
+		{name: "malformed bearer token", authorization: "Bearer not-a-jwt", expectedKind: KindMalformedToken},
+		{
+			name:          "expired bearer token",
+			authorization: "Bearer " + issuer.sign(t, issuer.key, map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()}),
+			expectedKind:  KindExpiredToken,
+		},
+		{
+			name:          "bearer token signed by another key",
+			authorization: "Bearer " + issuer.sign(t, otherKey, nil),
+			expectedKind:  KindInvalidSignature,
+		},
+		{
+			name:          "bearer token for another audience",
+			authorization: "Bearer " + issuer.sign(t, issuer.key, map[string]interface{}{"aud": "https://other.api.com"}),
+			expectedKind:  KindInvalidAudience,
+		},
+		{
+			name:          "bearer token from another issuer",
+			authorization: "Bearer " + issuer.sign(t, issuer.key, map[string]interface{}{"iss": "https://evil.auth0.com/"}),
+			expectedKind:  KindInvalidIssuer,
+		},
+		{name: "expired session token", sessionToken: sessionToken(t, "secret", -60), expectedKind: KindExpiredToken},
+		{name: "session token with a bad signature", sessionToken: sessionToken(t, "other-secret", 3600), expectedKind: KindInvalidSignature},
+		{name: "malformed session token", sessionToken: "abcd", expectedKind: KindMalformedToken},
+		{
+			name:          "invalid session token with a valid bearer token",
+			sessionToken:  sessionToken(t, "other-secret", 3600),
+			authorization: "Bearer " + issuer.sign(t, issuer.key, nil),
+			expectedUser:  "123456789",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/data", nil)
+			if tt.sessionToken != "" {
+				req.Header.Set("x-tidepool-session-token", tt.sessionToken)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			tokenData, err := client.AuthenticateWithError(req)
+			if tt.expectedKind != "" {
+				assert.Nil(t, tokenData)
+				stackErr, ok := err.(blperr.StackError)
+				assert.True(t, ok)
+				assert.Equal(t, tt.expectedKind, stackErr.Kind(), err)
+				assert.Nil(t, client.Authenticate(req))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expectedUser, tokenData.UserId)
+			assert.Equal(t, tokenData, client.Authenticate(req))
+		})
+	}
+}
+
+func TestClient_AuthenticateLogsTheReason(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+	checker := RevocationCheckerFunc(func(ctx context.Context, identity TokenIdentity) (bool, error) {
+		return false, errors.New("revocation list unavailable")
+	})
+	fake := NewFakeWithOptions([]FakeUser{{UserID: "123", Role: "hcp"}}, WithRevocationChecker(checker))
+
+	assert.Nil(t, fake.Authenticate(fake.Request(http.MethodGet, "/data", "123")))
+	assert.Contains(t, output.String(), KindInvalidToken)
+	assert.Contains(t, output.String(), "revocation list unavailable")
+}
+
+func TestHTTPStatusAndWWWAuthenticate(t *testing.T) {
+	missing := newAuthError(KindMissingToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatus(missing))
+	assert.Equal(t, "Bearer", WWWAuthenticate(missing))
+
+	expired := newAuthError(KindExpiredToken, errors.New("token is expired"))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatus(expired))
+	assert.Equal(t, `Bearer error="invalid_token", error_description="the authentication token has expired"`, WWWAuthenticate(expired))
+
+	audience := newAuthError(KindInvalidAudience, errors.New("invalid audience"))
+	assert.Equal(t, http.StatusForbidden, HTTPStatus(audience))
+	assert.Equal(t, `Bearer error="insufficient_scope", error_description="the authentication token was not issued for this service"`, WWWAuthenticate(audience))
+}
+
+func TestClient_MultipleIssuers(t *testing.T) {
+	oldTenant, _ := NewTokenSigner("https://yourloops.eu.auth0.com", "https://api.yourloops.com")
+	newTenant, _ := NewTokenSigner("https://auth.yourloops.com/", "https://api.yourloops.com")
+	partnerTenant, _ := NewTokenSigner("https://partner.eu.auth0.com/", "https://partner.yourloops.com")
+	newKeys, partnerKeys := newTenant.KeySet(), partnerTenant.KeySet()
+	fetches := 0
+	unknownTenant := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		fetches++
+		res.WriteHeader(http.StatusNotFound)
+	}))
+	defer unknownTenant.Close()
+
+	client, err := NewClientWithOptions("secret", append(oldTenant.ClientOptions(),
+		WithIssuers(
+			IssuerConfig{URL: "https://auth.yourloops.com", KeySet: &newKeys},
+			IssuerConfig{URL: "https://partner.eu.auth0.com", Audiences: []string{"https://partner.yourloops.com"}, KeySet: &partnerKeys},
+		),
+	)...)
+	assert.Nil(t, err)
+
+	for _, signer := range []*TokenSigner{oldTenant, newTenant, partnerTenant} {
+		rawToken, _ := signer.SignUser("123456789", "hcp")
+		tokenData, err := authenticate(client, rawToken)
+		assert.Nil(t, err, signer.Issuer)
+		assert.Equal(t, "123456789", tokenData.UserId)
+	}
+
+	// each issuer has its own keys
+	rawToken, _ := oldTenant.Sign(map[string]interface{}{"sub": "auth0|123", "iss": newTenant.Issuer})
+	_, err = authenticate(client, rawToken)
+	assert.Equal(t, KindInvalidSignature, err.(blperr.StackError).Kind())
+
+	// and its own audiences
+	rawToken, _ = partnerTenant.Sign(map[string]interface{}{"sub": "auth0|123", "aud": "https://api.yourloops.com"})
+	_, err = authenticate(client, rawToken)
+	assert.Equal(t, KindInvalidAudience, err.(blperr.StackError).Kind())
+
+	rawToken, _ = oldTenant.Sign(map[string]interface{}{"sub": "auth0|123", "iss": unknownTenant.URL + "/"})
+	_, err = authenticate(client, rawToken)
+	assert.Equal(t, KindInvalidIssuer, err.(blperr.StackError).Kind())
+	assert.Equal(t, 0, fetches)
+}
+
+func TestNewClient_AdditionalIssuers(t *testing.T) {
+	t.Setenv("AUTH0_URL", "https://yourloops.eu.auth0.com")
+	t.Setenv("AUTH0_ADDITIONAL_URLS", "https://auth.yourloops.com/, https://other.eu.auth0.com")
+	t.Setenv("AUTH0_AUDIENCE", "https://api.yourloops.com")
+	client, err := NewClient("secret")
+	assert.Nil(t, err)
+	assert.Len(t, client.issuers, 3)
+	assert.Contains(t, client.issuers, "https://auth.yourloops.com/")
+	assert.Contains(t, client.issuers, "https://other.eu.auth0.com/")
+}
+
+func TestNewClientWithOptions_Issuers(t *testing.T) {
+	_, err := NewClientWithOptions("secret", WithIssuers(IssuerConfig{URL: "https://auth.yourloops.com", Audiences: []string{"api"}}))
+	assert.Nil(t, err)
+	_, err = NewClientWithOptions("secret", WithIssuers(IssuerConfig{URL: "https://auth.yourloops.com"}))
+	assert.NotNil(t, err)
+	_, err = NewClientWithOptions("secret", WithIssuerURL("https://yourloops.eu.auth0.com"), WithAudiences("api"), WithIssuers(IssuerConfig{}))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/sha256"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/mdblp/go-common/v2/internal/lru"
+	"github.com/mdblp/shoreline/token"
+)
+
+// CacheStats are the metrics of the decision cache of the Auth Client
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the current number of cached tokens
+	Size int
+}
+
+// decision is the result of the authentication of a token, cached until the token expires
+type decision struct {
+	tokenData *token.TokenData
+	// claims and registeredClaims are only set for bearer tokens
+	claims           *Claims
+	registeredClaims validator.RegisteredClaims
+}
+
+type decisionKey [sha256.Size]byte
+
+// the header is part of the key, a token is authenticated differently as a session token and as a bearer token
+func newDecisionKey(header string, rawToken string) decisionKey {
+	return sha256.Sum256([]byte(header + ":" + rawToken))
+}
+
+// copy returns a decision whose tokenData and claims are copies, the callers may modify them
+func (d decision) copy() decision {
+	tokenData := *d.tokenData
+	result := decision{tokenData: &tokenData, registeredClaims: d.registeredClaims}
+	if d.claims != nil {
+		claims := *d.claims
+		result.claims = &claims
+	}
+	return result
+}
+
+// cachedDecision returns a copy of the cached decision of a token
+func (client *Client) cachedDecision(key decisionKey) (decision, bool) {
+	if client.decisions == nil {
+		return decision{}, false
+	}
+	cached, ok := client.decisions.Get(key)
+	if !ok {
+		return decision{}, false
+	}
+	return cached.copy(), true
+}
+
+// cacheDecision caches a successful authentication until the token expires, tokens without expiration are not cached
+func (client *Client) cacheDecision(key decisionKey, rawToken string, result decision) {
+	if client.decisions == nil {
+		return
+	}
+	if expiresAt, ok := jwtExpiry(rawToken); ok {
+		client.decisions.Add(key, result.copy(), expiresAt)
+	}
+}
+
+// CacheStats returns the hits, misses and size of the decision cache, see WithDecisionCache
+func (client *Client) CacheStats() CacheStats {
+	if client.decisions == nil {
+		return CacheStats{}
+	}
+	stats := client.decisions.Stats()
+	return CacheStats{Hits: stats.Hits, Misses: stats.Misses, Size: stats.Size}
+}
+
+func newDecisionCache(size int) *lru.Cache[decisionKey, decision] {
+	if size <= 0 {
+		return nil
+	}
+	return lru.New[decisionKey, decision](size)
+}
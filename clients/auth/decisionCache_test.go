@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_DecisionCache(t *testing.T) {
+	signer := newTestSigner(t)
+	revocations := NewMemoryRevocationList(time.Hour)
+	client, err := NewClientWithOptions("secret", append(signer.ClientOptions(),
+		WithDecisionCache(10),
+		WithRevocationChecker(revocations),
+	)...)
+	assert.Nil(t, err)
+
+	rawToken, _ := signer.SignUser("123456789", "hcp")
+	for i := 0; i < 3; i++ {
+		tokenData, err := authenticate(client, rawToken)
+		assert.Nil(t, err)
+		assert.Equal(t, &token.TokenData{UserId: "123456789", Role: "hcp"}, tokenData)
+		// callers get their own copy
+		tokenData.Role = "patient"
+	}
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, client.CacheStats())
+
+	t.Run("Checks the revocation of cached tokens", func(t *testing.T) {
+		revocations.RevokeSubject("auth0|123456789")
+		_, err := authenticate(client, rawToken)
+		assert.Equal(t, KindRevokedToken, err.(blperr.StackError).Kind())
+	})
+	t.Run("Does not cache the failures", func(t *testing.T) {
+		otherSigner := newTestSigner(t)
+		otherToken, _ := otherSigner.SignUser("123456789", "hcp")
+		for i := 0; i < 2; i++ {
+			_, err := authenticate(client, otherToken)
+			assert.NotNil(t, err)
+		}
+		assert.Equal(t, 1, client.CacheStats().Size)
+	})
+	t.Run("Caches the session tokens", func(t *testing.T) {
+		stats := client.CacheStats()
+		req := httptest.NewRequest(http.MethodGet, "/data", nil)
+		req.Header.Set(token.TP_SESSION_TOKEN, sessionToken(t, "secret", 3600))
+		for i := 0; i < 2; i++ {
+			tokenData, err := client.AuthenticateWithError(req)
+			assert.Nil(t, err)
+			assert.Equal(t, "00004", tokenData.UserId)
+		}
+		assert.Equal(t, stats.Hits+1, client.CacheStats().Hits)
+		assert.Equal(t, stats.Size+1, client.CacheStats().Size)
+	})
+	t.Run("Does not cache expired tokens", func(t *testing.T) {
+		size := client.CacheStats().Size
+		signer.TTL = -time.Minute
+		expiredToken, _ := signer.SignUser("123456789", "hcp")
+		_, err := authenticate(client, expiredToken)
+		assert.NotNil(t, err)
+		assert.Equal(t, size, client.CacheStats().Size)
+	})
+}
+
+func TestClient_CacheStatsWithoutCache(t *testing.T) {
+	signer := newTestSigner(t)
+	client, _ := NewClientWithOptions("secret", signer.ClientOptions()...)
+	rawToken, _ := signer.SignUser("123456789", "hcp")
+	_, err := authenticate(client, rawToken)
+	assert.Nil(t, err)
+	assert.Equal(t, CacheStats{}, client.CacheStats())
+}
+
+func BenchmarkClient_Authenticate(b *testing.B) {
+	signer, _ := NewTokenSigner(offlineIssuer, "https://api.yourloops.com")
+	rawToken, _ := signer.SignUser("123456789", "hcp")
+	session, _ := token.CreateSessionToken(
+		&token.TokenData{UserId: "00004", Role: "patient", DurationSecs: 3600},
+		token.TokenConfig{Secret: "secret", DurationSecs: 3600},
+	)
+	bearerRequest := httptest.NewRequest(http.MethodGet, "/data", nil)
+	bearerRequest.Header.Set("Authorization", "Bearer "+rawToken)
+	sessionRequest := httptest.NewRequest(http.MethodGet, "/data", nil)
+	sessionRequest.Header.Set(token.TP_SESSION_TOKEN, session.ID)
+
+	for _, cacheSize := range []int{0, 1000} {
+		client, _ := NewClientWithOptions("secret", append(signer.ClientOptions(), WithDecisionCache(cacheSize))...)
+		name := "without cache"
+		if cacheSize > 0 {
+			name = "with cache"
+		}
+		for _, req := range []struct {
+			name string
+			req  *http.Request
+		}{{"bearer token", bearerRequest}, {"session token", sessionRequest}} {
+			b.Run(req.name+" "+name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := client.AuthenticateWithError(req.req); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	legacyjwt "github.com/golang-jwt/jwt"
+	"github.com/mdblp/go-common/v2/blperr"
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+// Kinds of the StackError returned by AuthenticateWithError
+const (
+	// KindMissingToken: the request carries neither a session token nor a bearer token
+	KindMissingToken = "auth-missing-token"
+	// KindMalformedToken: the token cannot be parsed, or the authorization header is not a bearer one
+	KindMalformedToken = "auth-malformed-token"
+	// KindExpiredToken: the token has expired, or is not valid yet
+	KindExpiredToken = "auth-expired-token"
+	// KindRevokedToken: the token was revoked (see RevocationChecker)
+	KindRevokedToken = "auth-revoked-token"
+	// KindInvalidSignature: the token signature cannot be verified
+	KindInvalidSignature = "auth-invalid-signature"
+	// KindInvalidIssuer: the token was not issued by a trusted issuer
+	KindInvalidIssuer = "auth-invalid-issuer"
+	// KindInvalidAudience: the token was not issued for this service
+	KindInvalidAudience = "auth-invalid-audience"
+	// KindInvalidClaims: the token claims do not match what the service expects
+	KindInvalidClaims = "auth-invalid-claims"
+	// KindInvalidToken: the token is rejected for any other reason
+	KindInvalidToken = "auth-invalid-token"
+)
+
+var authErrorMessages = map[string]string{
+	KindMissingToken:     "no authentication token",
+	KindMalformedToken:   "the authentication token is malformed",
+	KindExpiredToken:     "the authentication token has expired",
+	KindRevokedToken:     "the authentication token has been revoked",
+	KindInvalidSignature: "the authentication token signature is invalid",
+	KindInvalidIssuer:    "the authentication token issuer is not trusted",
+	KindInvalidAudience:  "the authentication token was not issued for this service",
+	KindInvalidClaims:    "the authentication token claims are invalid",
+	KindInvalidToken:     "the authentication token is invalid",
+}
+
+func newAuthError(kind string, cause error) blperr.StackError {
+	details := map[string]interface{}{}
+	if cause != nil {
+		details["reason"] = cause.Error()
+	}
+	return blperr.NewWithDetails(kind, authErrorMessages[kind], details)
+}
+
+// bearerTokenError maps the errors of the jwt validator to an authentication error
+func bearerTokenError(err error) blperr.StackError {
+	switch {
+	case errors.Is(err, jwt.ErrExpired), errors.Is(err, jwt.ErrNotValidYet), errors.Is(err, jwt.ErrIssuedInTheFuture):
+		return newAuthError(KindExpiredToken, err)
+	case errors.Is(err, jwt.ErrInvalidAudience):
+		return newAuthError(KindInvalidAudience, err)
+	case errors.Is(err, jwt.ErrInvalidIssuer), errors.Is(err, errUnknownIssuer):
+		return newAuthError(KindInvalidIssuer, err)
+	case errors.Is(err, jose.ErrCryptoFailure):
+		return newAuthError(KindInvalidSignature, err)
+	case errors.Is(err, errMalformedToken):
+		return newAuthError(KindMalformedToken, err)
+	case errors.As(err, new(*json.UnmarshalTypeError)), errors.Is(err, errEmailNotVerified):
+		return newAuthError(KindInvalidClaims, err)
+	default:
+		return newAuthError(KindInvalidToken, err)
+	}
+}
+
+// sessionTokenError maps the errors returned when unpacking a legacy session token to an authentication error
+func sessionTokenError(err error) blperr.StackError {
+	var validationErr *legacyjwt.ValidationError
+	if errors.As(err, &validationErr) {
+		switch {
+		case validationErr.Errors&legacyjwt.ValidationErrorMalformed != 0:
+			return newAuthError(KindMalformedToken, err)
+		case validationErr.Errors&(legacyjwt.ValidationErrorExpired|legacyjwt.ValidationErrorNotValidYet|legacyjwt.ValidationErrorIssuedAt) != 0:
+			return newAuthError(KindExpiredToken, err)
+		case validationErr.Errors&legacyjwt.ValidationErrorSignatureInvalid != 0:
+			return newAuthError(KindInvalidSignature, err)
+		}
+	}
+	return newAuthError(KindInvalidToken, err)
+}
+
+// HTTPStatus returns the http status code matching an error returned by AuthenticateWithError:
+// 403 when the token is valid but was not issued for this service, 401 otherwise
+func HTTPStatus(err error) int {
+	var stackErr blperr.StackError
+	if errors.As(err, &stackErr) && stackErr.Kind() == KindInvalidAudience {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// WWWAuthenticate returns the value of the WWW-Authenticate header (RFC 6750) matching an error returned by AuthenticateWithError
+func WWWAuthenticate(err error) string {
+	var stackErr blperr.StackError
+	if !errors.As(err, &stackErr) || stackErr.Kind() == KindMissingToken {
+		return "Bearer"
+	}
+	errorCode := "invalid_token"
+	if stackErr.Kind() == KindInvalidAudience {
+		errorCode = "insufficient_scope"
+	}
+	return fmt.Sprintf(`Bearer error="%s", error_description="%s"`, errorCode, stackErr.Message())
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var errMalformedToken = errors.New("the token is not a JWT")
+
+// decodeJwtPart decodes the json header (index 0) or payload (index 1) of a JWT, without verifying its signature
+func decodeJwtPart(token string, index int, v interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return errMalformedToken
+	}
+	part, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[index], "="))
+	if err != nil {
+		return errMalformedToken
+	}
+	if err := json.Unmarshal(part, v); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedToken, err)
+	}
+	return nil
+}
+
+// jwtAlgorithm reads the signature algorithm from the header of a JWT
+func jwtAlgorithm(token string) (string, error) {
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJwtPart(token, 0, &header); err != nil {
+		return "", err
+	}
+	return header.Algorithm, nil
+}
+
+// jwtIssuer reads the iss claim of a JWT, without verifying its signature
+func jwtIssuer(token string) (string, error) {
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := decodeJwtPart(token, 1, &claims); err != nil {
+		return "", err
+	}
+	return claims.Issuer, nil
+}
+
+// jwtExpiry reads the exp claim of a JWT, without verifying its signature
+func jwtExpiry(token string) (time.Time, bool) {
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := decodeJwtPart(token, 1, &claims); err != nil || claims.Expiry == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Expiry, 0), true
+}
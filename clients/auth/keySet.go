@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/auth0/go-jwt-middleware/v2/jwks"
+	"gopkg.in/go-jose/go-jose.v2"
+)
+
+// keyFunc returns the keys used by the validators of an issuer to verify the signature of the tokens:
+// the static key set of the issuer when there is one, otherwise the JWKS fetched from the issuer
+func (o *clientOptions) keyFunc(issuerURL *url.URL, keySet *jose.JSONWebKeySet, keySetFile string) (func(context.Context) (interface{}, error), error) {
+	if keySet == nil && keySetFile != "" {
+		var err error
+		if keySet, err = LoadKeySet(keySetFile); err != nil {
+			return nil, err
+		}
+	}
+	if keySet != nil {
+		return staticKeyFunc(*keySet)
+	}
+
+	providerOpts := []interface{}{}
+	if o.httpClient != nil {
+		providerOpts = append(providerOpts, jwks.WithCustomClient(o.httpClient))
+	}
+	return jwks.NewCachingProvider(issuerURL, o.jwksCacheTTL, providerOpts...).KeyFunc, nil
+}
+
+// staticKeyFunc returns the public keys of a key set.
+// A single key is used whatever the key id of the tokens, with several keys the tokens must carry a key id.
+func staticKeyFunc(keySet jose.JSONWebKeySet) (func(context.Context) (interface{}, error), error) {
+	if len(keySet.Keys) == 0 {
+		return nil, errors.New("the key set is empty")
+	}
+	publicKeys := jose.JSONWebKeySet{Keys: make([]jose.JSONWebKey, 0, len(keySet.Keys))}
+	for _, key := range keySet.Keys {
+		if !key.Valid() {
+			return nil, fmt.Errorf("invalid key [%s] in the key set", key.KeyID)
+		}
+		publicKeys.Keys = append(publicKeys.Keys, key.Public())
+	}
+	if len(publicKeys.Keys) == 1 {
+		key := publicKeys.Keys[0].Key
+		return func(context.Context) (interface{}, error) { return key, nil }, nil
+	}
+	return func(context.Context) (interface{}, error) { return &publicKeys, nil }, nil
+}
+
+// LoadKeySet reads a key set from a file, either a JWKS (json) or a PEM bundle (see ParsePEMKeySet)
+func LoadKeySet(path string) (*jose.JSONWebKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key set: %w", err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		return ParsePEMKeySet(data)
+	}
+	var keySet jose.JSONWebKeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to parse the key set: %w", err)
+	}
+	return &keySet, nil
+}
+
+// ParsePEMKeySet reads the public keys (PUBLIC KEY, RSA PUBLIC KEY) and certificates (CERTIFICATE) of a PEM bundle.
+// The id of each key is its RFC 7638 thumbprint (base64url encoded SHA-256).
+func ParsePEMKeySet(data []byte) (*jose.JSONWebKeySet, error) {
+	keySet := &jose.JSONWebKeySet{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var publicKey interface{}
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			publicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			publicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				publicKey = cert.PublicKey
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PEM block [%s] in the key set", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse a PEM block of the key set: %w", err)
+		}
+		key := jose.JSONWebKey{Key: publicKey, Use: "sig"}
+		thumbprint, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported key in the key set: %w", err)
+		}
+		key.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+		keySet.Keys = append(keySet.Keys, key)
+	}
+	if len(keySet.Keys) == 0 {
+		return nil, errors.New("no PEM block in the key set")
+	}
+	return keySet, nil
+}
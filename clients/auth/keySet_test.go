@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+// the issuer cannot be resolved, any attempt to fetch its JWKS fails
+const offlineIssuer = "https://yourloops.invalid/"
+
+func newTestSigner(t *testing.T) *TokenSigner {
+	signer, err := NewTokenSigner(offlineIssuer, "https://api.yourloops.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func authenticate(client *Client, rawToken string) (*token.TokenData, error) {
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("Authorization", "Bearer "+rawToken)
+	return client.AuthenticateWithError(req)
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func publicKeyPEM(t *testing.T, signer *TokenSigner) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&signer.key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestClient_OfflineKeySet(t *testing.T) {
+	signer := newTestSigner(t)
+	client, err := NewClientWithOptions("secret", signer.ClientOptions()...)
+	assert.Nil(t, err)
+
+	rawToken, err := signer.SignUser("123456789", "hcp")
+	assert.Nil(t, err)
+	tokenData, err := authenticate(client, rawToken)
+	assert.Nil(t, err)
+	assert.Equal(t, &token.TokenData{UserId: "123456789", Role: "hcp"}, tokenData)
+
+	otherSigner := newTestSigner(t)
+	rawToken, _ = otherSigner.SignUser("123456789", "hcp")
+	_, err = authenticate(client, rawToken)
+	assert.Equal(t, KindInvalidSignature, err.(blperr.StackError).Kind())
+
+	signer.TTL = -time.Minute
+	rawToken, _ = signer.SignUser("123456789", "hcp")
+	_, err = authenticate(client, rawToken)
+	assert.Equal(t, KindExpiredToken, err.(blperr.StackError).Kind())
+}
+
+func TestClient_KeySetFile(t *testing.T) {
+	signer := newTestSigner(t)
+	otherSigner := newTestSigner(t)
+	jwks, _ := json.Marshal(signer.KeySet())
+
+	tests := []struct {
+		name    string
+		file    []byte
+		wantErr bool
+	}{
+		{name: "JWKS", file: jwks},
+		{name: "PEM public key", file: publicKeyPEM(t, signer)},
+		{
+			name: "PEM RSA public key",
+			file: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&signer.key.PublicKey)}),
+		},
+		{name: "not a key set", file: []byte("{"), wantErr: true},
+		{name: "empty JWKS", file: []byte(`{"keys":[]}`), wantErr: true},
+		{name: "private key PEM", file: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(signer.key)}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClientWithOptions("secret",
+				WithIssuerURL(signer.Issuer),
+				WithAudiences(signer.Audience),
+				WithKeySetFile(writeFile(t, "keys", tt.file)),
+			)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			rawToken, _ := signer.SignUser("123456789", "hcp")
+			_, err = authenticate(client, rawToken)
+			assert.Nil(t, err)
+			rawToken, _ = otherSigner.SignUser("123456789", "hcp")
+			_, err = authenticate(client, rawToken)
+			assert.NotNil(t, err)
+		})
+	}
+
+	_, err := NewClientWithOptions("secret", WithIssuerURL(signer.Issuer), WithAudiences(signer.Audience), WithKeySetFile("/does/not/exist"))
+	assert.NotNil(t, err)
+}
+
+func TestParsePEMKeySet(t *testing.T) {
+	signer := newTestSigner(t)
+	otherSigner := newTestSigner(t)
+	keySet, err := ParsePEMKeySet(append(publicKeyPEM(t, signer), publicKeyPEM(t, otherSigner)...))
+	assert.Nil(t, err)
+	assert.Len(t, keySet.Keys, 2)
+	assert.NotEqual(t, keySet.Keys[0].KeyID, keySet.Keys[1].KeyID)
+
+	// with several keys, the key is selected by its id
+	client, err := NewClientWithOptions("secret", WithIssuerURL(signer.Issuer), WithAudiences(signer.Audience), WithKeySet(*keySet))
+	assert.Nil(t, err)
+	rawToken, _ := signer.SignUser("123456789", "hcp")
+	_, err = authenticate(client, rawToken)
+	assert.NotNil(t, err)
+
+	_, err = ParsePEMKeySet([]byte("not a pem"))
+	assert.NotNil(t, err)
+}
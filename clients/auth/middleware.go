@@ -0,0 +1,163 @@
+package auth
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mdblp/go-common/v2/clients/status"
+	"github.com/mdblp/go-common/v2/context"
+	"github.com/mdblp/shoreline/token"
+)
+
+// Requirement is checked on the token data of an authenticated request, the request is rejected with a 403
+// when it returns an error. claims are nil for the requests authenticated with a legacy session token.
+type Requirement func(tokenData *token.TokenData, claims *Claims) error
+
+type claimsKeyType int
+
+const claimsKey claimsKeyType = iota + 1
+
+// GetClaims returns the claims of the bearer token from the context, set by the Middleware.
+// There is no claims for the requests authenticated with a legacy session token.
+func GetClaims(ctx stdcontext.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// RequireServerToken requires a server token (a machine to machine token or a shoreline server token)
+func RequireServerToken() Requirement {
+	return func(tokenData *token.TokenData, _ *Claims) error {
+		if !tokenData.IsServer {
+			return errors.New("a server token is required")
+		}
+		return nil
+	}
+}
+
+// RequireRole requires a user token with one of the given roles
+func RequireRole(roles ...string) Requirement {
+	return func(tokenData *token.TokenData, _ *Claims) error {
+		for _, role := range roles {
+			if tokenData.Role == role {
+				return nil
+			}
+		}
+		return fmt.Errorf("role [%s] is not allowed", tokenData.Role)
+	}
+}
+
+// RequireServerTokenOrRole accepts a server token, or a user token with one of the given roles
+func RequireServerTokenOrRole(roles ...string) Requirement {
+	requireRole := RequireRole(roles...)
+	return func(tokenData *token.TokenData, claims *Claims) error {
+		if tokenData.IsServer {
+			return nil
+		}
+		return requireRole(tokenData, claims)
+	}
+}
+
+// RequireScopes requires a bearer token granted with all the given scopes
+func RequireScopes(scopes ...string) Requirement {
+	return func(_ *token.TokenData, claims *Claims) error {
+		if !claims.HasScopes(scopes...) {
+			return fmt.Errorf("scopes [%s] are required", strings.Join(scopes, " "))
+		}
+		return nil
+	}
+}
+
+// Middleware authenticates the incoming requests with an auth client and stores the token data
+// in the request context, where it is read with context.GetTokenData (and GetClaims for the bearer token claims).
+//
+// Requests which cannot be authenticated are rejected with a 401 (see HTTPStatus),
+// authenticated requests which do not meet a requirement are rejected with a 403.
+//
+// With net/http:
+//
+//	mux.Handle("/v1/data", authMiddleware.With(auth.RequireServerToken()).Handler(dataHandler))
+//
+// With gin, which does not use http.Handler middlewares:
+//
+//	router.Use(func(c *gin.Context) {
+//		req, ok := authMiddleware.Authenticate(c.Writer, c.Request)
+//		if !ok {
+//			c.Abort()
+//			return
+//		}
+//		c.Request = req
+//		c.Next()
+//	})
+type Middleware struct {
+	client       ClientInterface
+	requirements []Requirement
+}
+
+// NewMiddleware creates an authentication middleware, the requirements apply to every route using it
+func NewMiddleware(client ClientInterface, requirements ...Requirement) *Middleware {
+	return &Middleware{client: client, requirements: requirements}
+}
+
+// With returns a copy of the middleware, with additional requirements for a route
+func (m *Middleware) With(requirements ...Requirement) *Middleware {
+	all := make([]Requirement, 0, len(m.requirements)+len(requirements))
+	all = append(all, m.requirements...)
+	all = append(all, requirements...)
+	return &Middleware{client: m.client, requirements: all}
+}
+
+// Handler wraps a http.Handler, next is only called for the authenticated requests
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req, ok := m.Authenticate(res, req); ok {
+			next.ServeHTTP(res, req)
+		}
+	})
+}
+
+// HandlerFunc wraps a http.HandlerFunc, next is only called for the authenticated requests
+func (m *Middleware) HandlerFunc(next http.HandlerFunc) http.Handler {
+	return m.Handler(next)
+}
+
+// Authenticate authenticates a request and checks the requirements. It returns the request with the token data
+// in its context, or writes the error response and returns false.
+func (m *Middleware) Authenticate(res http.ResponseWriter, req *http.Request) (*http.Request, bool) {
+	tokenData, claims, err := m.authenticate(req)
+	if err != nil {
+		res.Header().Set("WWW-Authenticate", WWWAuthenticate(err))
+		code := HTTPStatus(err)
+		writeStatus(res, status.NewStatus(code, http.StatusText(code)))
+		return nil, false
+	}
+	for _, requirement := range m.requirements {
+		if err := requirement(tokenData, claims); err != nil {
+			writeStatus(res, status.NewStatus(http.StatusForbidden, err.Error()))
+			return nil, false
+		}
+	}
+	ctx := context.SetTokenData(req.Context(), tokenData)
+	if claims != nil {
+		ctx = stdcontext.WithValue(ctx, claimsKey, claims)
+	}
+	return req.WithContext(ctx), true
+}
+
+// authenticate returns the claims of the token when the client exposes them (see ClaimsAuthenticator)
+func (m *Middleware) authenticate(req *http.Request) (*token.TokenData, *Claims, error) {
+	if authenticator, ok := m.client.(ClaimsAuthenticator); ok {
+		return authenticator.AuthenticateWithClaims(req)
+	}
+	tokenData, err := m.client.AuthenticateWithError(req)
+	return tokenData, nil, err
+}
+
+func writeStatus(res http.ResponseWriter, s status.Status) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(s.Code)
+	_ = json.NewEncoder(res).Encode(s)
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/go-common/v2/context"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMiddleware(t *testing.T) {
+	patient := &token.TokenData{UserId: "123", Role: "patient"}
+	hcp := &token.TokenData{UserId: "456", Role: "hcp"}
+	server := &token.TokenData{UserId: "AbCd@clients", IsServer: true}
+
+	tests := []struct {
+		name         string
+		tokenData    *token.TokenData
+		claims       *Claims
+		err          error
+		requirements []Requirement
+		expectedCode int
+	}{
+		{name: "authenticated request", tokenData: patient, expectedCode: http.StatusOK},
+		{name: "missing token", err: newAuthError(KindMissingToken, nil), expectedCode: http.StatusUnauthorized},
+		{name: "expired token", err: newAuthError(KindExpiredToken, nil), expectedCode: http.StatusUnauthorized},
+		{name: "server token required", tokenData: server, requirements: []Requirement{RequireServerToken()}, expectedCode: http.StatusOK},
+		{name: "user token on a server route", tokenData: patient, requirements: []Requirement{RequireServerToken()}, expectedCode: http.StatusForbidden},
+		{name: "allowed role", tokenData: hcp, requirements: []Requirement{RequireRole("hcp", "caregiver")}, expectedCode: http.StatusOK},
+		{name: "not allowed role", tokenData: patient, requirements: []Requirement{RequireRole("hcp", "caregiver")}, expectedCode: http.StatusForbidden},
+		{name: "server token on a role route", tokenData: server, requirements: []Requirement{RequireRole("hcp")}, expectedCode: http.StatusForbidden},
+		{name: "server token or role with a server", tokenData: server, requirements: []Requirement{RequireServerTokenOrRole("hcp")}, expectedCode: http.StatusOK},
+		{name: "server token or role with a user", tokenData: patient, requirements: []Requirement{RequireServerTokenOrRole("hcp")}, expectedCode: http.StatusForbidden},
+		{
+			name:         "granted scopes",
+			tokenData:    server,
+			claims:       &Claims{Scopes: []string{"read:data", "write:data"}},
+			requirements: []Requirement{RequireScopes("read:data", "write:data")},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "missing scope",
+			tokenData:    server,
+			claims:       &Claims{Scopes: []string{"read:data"}},
+			requirements: []Requirement{RequireScopes("read:data", "write:data")},
+			expectedCode: http.StatusForbidden,
+		},
+		{name: "scopes with a session token", tokenData: server, requirements: []Requirement{RequireScopes("read:data")}, expectedCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewMock()
+			client.On("AuthenticateWithClaims", mock.Anything).Return(tt.tokenData, tt.claims, tt.err)
+			var handlerTokenData *token.TokenData
+			var handlerClaims *Claims
+			handler := NewMiddleware(client).With(tt.requirements...).HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				handlerTokenData, _ = context.GetTokenData(req.Context())
+				handlerClaims, _ = GetClaims(req.Context())
+			})
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/data", nil))
+
+			assert.Equal(t, tt.expectedCode, res.Code)
+			if tt.expectedCode == http.StatusOK {
+				assert.Equal(t, tt.tokenData, handlerTokenData)
+				assert.Equal(t, tt.claims, handlerClaims)
+				return
+			}
+			assert.Nil(t, handlerTokenData)
+			assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+			if tt.expectedCode == http.StatusUnauthorized {
+				assert.Equal(t, WWWAuthenticate(tt.err), res.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestMiddleware_WithDoesNotChangeTheParent(t *testing.T) {
+	client := NewMock()
+	client.On("AuthenticateWithClaims", mock.Anything).Return(&token.TokenData{UserId: "123", Role: "patient"}, nil, nil)
+	parent := NewMiddleware(client)
+	parent.With(RequireServerToken())
+
+	_, ok := parent.Authenticate(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data", nil))
+	assert.True(t, ok)
+}
+
+// errorClient only implements ClientInterface
+type errorClient struct {
+	tokenData *token.TokenData
+	err       error
+}
+
+func (client errorClient) Authenticate(req *http.Request) *token.TokenData {
+	return client.tokenData
+}
+
+func (client errorClient) AuthenticateWithError(req *http.Request) (*token.TokenData, error) {
+	return client.tokenData, client.err
+}
+
+func TestMiddleware_WithoutClaims(t *testing.T) {
+	middleware := NewMiddleware(errorClient{tokenData: &token.TokenData{UserId: "123", Role: "hcp"}}, RequireRole("hcp"))
+	req, ok := middleware.Authenticate(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/data", nil))
+	assert.True(t, ok)
+	_, hasClaims := GetClaims(req.Context())
+	assert.False(t, hasClaims)
+
+	res := httptest.NewRecorder()
+	_, ok = NewMiddleware(errorClient{err: newAuthError(KindMissingToken, nil)}).Authenticate(res, httptest.NewRequest(http.MethodGet, "/data", nil))
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"gopkg.in/go-jose/go-jose.v2"
+)
+
+// DefaultRoleClaim is the claim holding the roles of the user in the YourLoops tokens
+const DefaultRoleClaim = "http://your-loops.com/roles"
+
+const (
+	defaultClockSkew    = time.Minute
+	defaultJWKSCacheTTL = 5 * time.Minute
+)
+
+// ClientOption configures the validation of the bearer tokens by the Auth Client
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	issuerURL    string
+	audiences    []string
+	algorithms   []validator.SignatureAlgorithm
+	clockSkew    time.Duration
+	jwksCacheTTL time.Duration
+	httpClient   *http.Client
+	roleClaim    string
+	defaultRole  string
+	// reject the user tokens whose email_verified claim is not true
+	requireVerifiedEmail bool
+	// static keys, used instead of the JWKS of the issuer
+	keySet     *jose.JSONWebKeySet
+	keySetFile string
+	// issuers trusted in addition to issuerURL
+	issuers           []IssuerConfig
+	revocationChecker RevocationChecker
+	decisionCacheSize int
+}
+
+// IssuerConfig is an issuer trusted by the Auth Client, in addition to the one set with WithIssuerURL
+type IssuerConfig struct {
+	// URL of the issuer (the Auth0 tenant), the JWKS are fetched from this url
+	URL string
+	// Audiences accepted for the tokens of this issuer, defaults to the ones set with WithAudiences
+	Audiences []string
+	// KeySet or KeySetFile, when set, are used instead of the JWKS of the issuer (see WithKeySet and WithKeySetFile)
+	KeySet     *jose.JSONWebKeySet
+	KeySetFile string
+}
+
+func defaultClientOptions() *clientOptions {
+	return &clientOptions{
+		algorithms:   []validator.SignatureAlgorithm{validator.RS256},
+		clockSkew:    defaultClockSkew,
+		jwksCacheTTL: defaultJWKSCacheTTL,
+		roleClaim:    DefaultRoleClaim,
+	}
+}
+
+// WithIssuerURL sets the url of the tokens issuer (the Auth0 tenant), the JWKS are fetched from this url
+func WithIssuerURL(issuerURL string) ClientOption {
+	return func(o *clientOptions) {
+		o.issuerURL = issuerURL
+	}
+}
+
+// WithIssuers trusts other issuers, for example while migrating tenants between Auth0 domains.
+// The issuer of a token is read from its iss claim, the tokens of an unknown issuer are rejected.
+func WithIssuers(issuers ...IssuerConfig) ClientOption {
+	return func(o *clientOptions) {
+		o.issuers = append(o.issuers, issuers...)
+	}
+}
+
+// WithAudiences sets the accepted audiences, a token must have been issued for one of them
+func WithAudiences(audiences ...string) ClientOption {
+	return func(o *clientOptions) {
+		o.audiences = audiences
+	}
+}
+
+// WithAllowedAlgorithms sets the accepted signature algorithms, defaults to RS256
+func WithAllowedAlgorithms(algorithms ...validator.SignatureAlgorithm) ClientOption {
+	return func(o *clientOptions) {
+		o.algorithms = algorithms
+	}
+}
+
+// WithClockSkew sets the clock skew allowed when checking the token dates, defaults to 1 minute
+func WithClockSkew(skew time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.clockSkew = skew
+	}
+}
+
+// WithJWKSCacheTTL sets how long the JWKS fetched from the issuer are cached, defaults to 5 minutes
+func WithJWKSCacheTTL(ttl time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.jwksCacheTTL = ttl
+	}
+}
+
+// WithKeySet sets the keys used to verify the tokens, instead of fetching the JWKS from the issuer.
+// The private keys of the set are never used, only their public part.
+func WithKeySet(keySet jose.JSONWebKeySet) ClientOption {
+	return func(o *clientOptions) {
+		o.keySet = &keySet
+	}
+}
+
+// WithKeySetFile loads the keys used to verify the tokens from a JWKS or PEM file (see LoadKeySet),
+// instead of fetching the JWKS from the issuer
+func WithKeySetFile(path string) ClientOption {
+	return func(o *clientOptions) {
+		o.keySetFile = path
+	}
+}
+
+// WithHTTPClient sets the http client used to fetch the JWKS
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(o *clientOptions) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithRoleClaim sets the claim from which the role of the user is read, defaults to DefaultRoleClaim.
+// The claim can be a string or an array of strings, in which case the first role is used.
+func WithRoleClaim(claim string) ClientOption {
+	return func(o *clientOptions) {
+		o.roleClaim = claim
+	}
+}
+
+// WithDefaultRole sets the role given to the tokens without any role (for example machine to machine tokens),
+// defaults to an empty role
+func WithDefaultRole(role string) ClientOption {
+	return func(o *clientOptions) {
+		o.defaultRole = role
+	}
+}
+
+// WithVerifiedEmailRequired rejects the user tokens whose email_verified claim is not true, with KindInvalidClaims.
+// Machine to machine tokens are not concerned. Disabled by default.
+func WithVerifiedEmailRequired(required bool) ClientOption {
+	return func(o *clientOptions) {
+		o.requireVerifiedEmail = required
+	}
+}
+
+// WithRevocationChecker rejects the bearer tokens revoked according to the checker, with KindRevokedToken.
+// The tokens are also rejected, with KindInvalidToken, when the checker fails.
+func WithRevocationChecker(checker RevocationChecker) ClientOption {
+	return func(o *clientOptions) {
+		o.revocationChecker = checker
+	}
+}
+
+// WithDecisionCache caches the authentication of up to size tokens (session and bearer tokens), until they expire.
+// The cache saves the signature verification of the tokens seen again, the revocation is still checked on each request.
+// Use Client.CacheStats to monitor it. Disabled by default.
+func WithDecisionCache(size int) ClientOption {
+	return func(o *clientOptions) {
+		o.decisionCacheSize = size
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenIdentity identifies a bearer token for the revocation checks
+type TokenIdentity struct {
+	// ID is the jti claim, empty when the issuer does not set it
+	ID string
+	// Subject is the sub claim, for example auth0|123456789
+	Subject string
+	// IssuedAt is the iat claim, zero when the issuer does not set it
+	IssuedAt time.Time
+}
+
+// RevocationChecker tells whether a bearer token was revoked, it is consulted by the Auth Client
+// after the validation of the token (see WithRevocationChecker).
+// Implement it on top of a shared store (redis, database...) to share the revocations between the instances of a service.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, identity TokenIdentity) (bool, error)
+}
+
+// RevocationCheckerFunc is an adapter to use a function as a RevocationChecker
+type RevocationCheckerFunc func(ctx context.Context, identity TokenIdentity) (bool, error)
+
+func (f RevocationCheckerFunc) IsRevoked(ctx context.Context, identity TokenIdentity) (bool, error) {
+	return f(ctx, identity)
+}
+
+// RevocationCheckers combines checkers, a token is revoked as soon as one of them says so.
+// Put the cheapest first, for example a MemoryRevocationList before a shared store.
+func RevocationCheckers(checkers ...RevocationChecker) RevocationChecker {
+	return RevocationCheckerFunc(func(ctx context.Context, identity TokenIdentity) (bool, error) {
+		for _, checker := range checkers {
+			if revoked, err := checker.IsRevoked(ctx, identity); err != nil || revoked {
+				return revoked, err
+			}
+		}
+		return false, nil
+	})
+}
+
+// MemoryRevocationList is an in-memory RevocationChecker.
+//
+// Revocations are kept for a TTL, which must be longer than the lifetime of the tokens:
+// once it is elapsed, the revoked tokens have expired anyway.
+type MemoryRevocationList struct {
+	ttl time.Duration
+	now func() time.Time
+	mu  sync.RWMutex
+	// expiration of the revocation, by token id
+	tokens map[string]time.Time
+	// revocations by subject
+	subjects map[string]subjectRevocation
+}
+
+type subjectRevocation struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// NewMemoryRevocationList creates an empty MemoryRevocationList whose revocations are kept for ttl
+func NewMemoryRevocationList(ttl time.Duration) *MemoryRevocationList {
+	return &MemoryRevocationList{
+		ttl:      ttl,
+		now:      time.Now,
+		tokens:   map[string]time.Time{},
+		subjects: map[string]subjectRevocation{},
+	}
+}
+
+// RevokeToken revokes the token with the given id (jti claim)
+func (l *MemoryRevocationList) RevokeToken(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.purge(now)
+	l.tokens[id] = now.Add(l.ttl)
+}
+
+// RevokeSubject revokes all the tokens of a subject (sub claim) issued until now,
+// for example when the user is deleted or signs out from every device
+func (l *MemoryRevocationList) RevokeSubject(subject string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.purge(now)
+	l.subjects[subject] = subjectRevocation{revokedAt: now, expiresAt: now.Add(l.ttl)}
+}
+
+// IsRevoked implements RevocationChecker
+func (l *MemoryRevocationList) IsRevoked(_ context.Context, identity TokenIdentity) (bool, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	now := l.now()
+	if expiresAt, ok := l.tokens[identity.ID]; ok && identity.ID != "" && now.Before(expiresAt) {
+		return true, nil
+	}
+	if revocation, ok := l.subjects[identity.Subject]; ok && now.Before(revocation.expiresAt) {
+		// iat has a one second precision, a token issued in the second of the revocation is revoked
+		return !identity.IssuedAt.After(revocation.revokedAt), nil
+	}
+	return false, nil
+}
+
+// purge removes the expired revocations, l.mu must be held
+func (l *MemoryRevocationList) purge(now time.Time) {
+	for id, expiresAt := range l.tokens {
+		if !now.Before(expiresAt) {
+			delete(l.tokens, id)
+		}
+	}
+	for subject, revocation := range l.subjects {
+		if !now.Before(revocation.expiresAt) {
+			delete(l.subjects, subject)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRevocationList(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	list := NewMemoryRevocationList(time.Hour)
+	list.now = func() time.Time { return now }
+
+	list.RevokeToken("token-1")
+	list.RevokeSubject("auth0|123")
+
+	tests := []struct {
+		name     string
+		identity TokenIdentity
+		expected bool
+	}{
+		{name: "revoked token id", identity: TokenIdentity{ID: "token-1", Subject: "auth0|456", IssuedAt: now}, expected: true},
+		{name: "other token id", identity: TokenIdentity{ID: "token-2", Subject: "auth0|456", IssuedAt: now}},
+		{name: "token without id", identity: TokenIdentity{Subject: "auth0|456", IssuedAt: now}},
+		{name: "token of a revoked subject", identity: TokenIdentity{Subject: "auth0|123", IssuedAt: now.Add(-time.Minute)}, expected: true},
+		{name: "token issued in the second of the revocation", identity: TokenIdentity{Subject: "auth0|123", IssuedAt: now}, expected: true},
+		{name: "token without iat of a revoked subject", identity: TokenIdentity{Subject: "auth0|123"}, expected: true},
+		{name: "token issued after the revocation", identity: TokenIdentity{Subject: "auth0|123", IssuedAt: now.Add(time.Second)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revoked, err := list.IsRevoked(context.TODO(), tt.identity)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, revoked)
+		})
+	}
+
+	t.Run("revocations expire after the ttl", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		revoked, _ := list.IsRevoked(context.TODO(), TokenIdentity{ID: "token-1"})
+		assert.False(t, revoked)
+		revoked, _ = list.IsRevoked(context.TODO(), TokenIdentity{Subject: "auth0|123"})
+		assert.False(t, revoked)
+
+		list.RevokeToken("token-3")
+		assert.Len(t, list.tokens, 1)
+		assert.Len(t, list.subjects, 0)
+	})
+}
+
+func TestRevocationCheckers(t *testing.T) {
+	list := NewMemoryRevocationList(time.Hour)
+	list.RevokeToken("token-1")
+	storeCalls := 0
+	store := RevocationCheckerFunc(func(ctx context.Context, identity TokenIdentity) (bool, error) {
+		storeCalls++
+		if identity.ID == "broken" {
+			return false, errors.New("store unavailable")
+		}
+		return identity.ID == "token-2", nil
+	})
+	checker := RevocationCheckers(list, store)
+
+	revoked, err := checker.IsRevoked(context.TODO(), TokenIdentity{ID: "token-1"})
+	assert.True(t, revoked)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, storeCalls)
+
+	revoked, _ = checker.IsRevoked(context.TODO(), TokenIdentity{ID: "token-2"})
+	assert.True(t, revoked)
+	revoked, _ = checker.IsRevoked(context.TODO(), TokenIdentity{ID: "token-3"})
+	assert.False(t, revoked)
+	_, err = checker.IsRevoked(context.TODO(), TokenIdentity{ID: "broken"})
+	assert.NotNil(t, err)
+}
+
+func TestClient_RevocationChecker(t *testing.T) {
+	signer := newTestSigner(t)
+	list := NewMemoryRevocationList(time.Hour)
+	store := RevocationCheckerFunc(func(ctx context.Context, identity TokenIdentity) (bool, error) {
+		if identity.ID == "broken" {
+			return false, errors.New("store unavailable")
+		}
+		return false, nil
+	})
+	client, err := NewClientWithOptions("secret", append(signer.ClientOptions(), WithRevocationChecker(RevocationCheckers(list, store)))...)
+	assert.Nil(t, err)
+
+	sign := func(jti string, subject string) string {
+		rawToken, _ := signer.Sign(map[string]interface{}{"jti": jti, "sub": subject, "iat": time.Now().Add(-time.Minute).Unix()})
+		return rawToken
+	}
+
+	_, err = authenticate(client, sign("token-1", "auth0|123"))
+	assert.Nil(t, err)
+
+	list.RevokeToken("token-1")
+	_, err = authenticate(client, sign("token-1", "auth0|123"))
+	assert.Equal(t, KindRevokedToken, err.(blperr.StackError).Kind())
+	_, err = authenticate(client, sign("token-2", "auth0|123"))
+	assert.Nil(t, err)
+
+	list.RevokeSubject("auth0|123")
+	_, err = authenticate(client, sign("token-2", "auth0|123"))
+	assert.Equal(t, KindRevokedToken, err.(blperr.StackError).Kind())
+	_, err = authenticate(client, sign("token-2", "auth0|456"))
+	assert.Nil(t, err)
+
+	_, err = authenticate(client, sign("broken", "auth0|456"))
+	assert.Equal(t, KindInvalidToken, err.(blperr.StackError).Kind())
+}
@@ -11,3 +11,10 @@ type TokenProviderFunc func() string
 func (t TokenProviderFunc) TokenProvide() string {
 	return t()
 }
+
+// RefreshableTokenProvider is a TokenProvider able to renew its token, when the current one is rejected
+type RefreshableTokenProvider interface {
+	TokenProvider
+	// RefreshToken discards the current token and returns a fresh one
+	RefreshToken() string
+}
@@ -0,0 +1,65 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NewAuthorization creates an Authorization with a defined result
+func NewAuthorization(authorized bool, route string, data map[string]interface{}) *Authorization {
+	return &Authorization{Result: &Result{Authorized: authorized, Route: route, Data: data}}
+}
+
+// IsAuthorized tells whether the policy allows the request, it is false when the result is undefined
+func (auth *Authorization) IsAuthorized() bool {
+	return auth != nil && auth.Result != nil && auth.Result.Authorized
+}
+
+// Route returns the route matched by the policy, it is empty when the result is undefined
+func (auth *Authorization) Route() string {
+	if auth == nil || auth.Result == nil {
+		return ""
+	}
+	return auth.Result.Route
+}
+
+// DataStrings returns a list of strings of the policy data, for example DataStrings("userIds").
+// A single string is returned as a list, the values which are not strings are ignored.
+// It is nil when the key or the result is undefined.
+func (auth *Authorization) DataStrings(key string) []string {
+	if auth == nil || auth.Result == nil {
+		return nil
+	}
+	switch value := auth.Result.Data[key].(type) {
+	case string:
+		return []string{value}
+	case []string:
+		return value
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// DecodeData unmarshals the policy data into target, a pointer to a struct with json tags.
+// target is left unchanged when the result is undefined.
+func (auth *Authorization) DecodeData(target interface{}) error {
+	if auth == nil || auth.Result == nil || auth.Result.Data == nil {
+		return nil
+	}
+	data, err := json.Marshal(auth.Result.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode the policy data: %w", err)
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("failed to decode the policy data: %w", err)
+	}
+	return nil
+}
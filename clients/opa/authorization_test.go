@@ -0,0 +1,63 @@
+package opa
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorization_Accessors(t *testing.T) {
+	var auth Authorization
+	assert.Nil(t, json.Unmarshal([]byte(`{
+		"result": {
+			"authorized": true,
+			"data": {"userIds": ["00004", "00005"], "teamId": "team-1", "count": 2, "mixed": ["a", 1]},
+			"route": "tidewhisperer-get"
+		}
+	}`), &auth))
+
+	assert.True(t, auth.IsAuthorized())
+	assert.Equal(t, "tidewhisperer-get", auth.Route())
+	assert.Equal(t, []string{"00004", "00005"}, auth.DataStrings("userIds"))
+	assert.Equal(t, []string{"team-1"}, auth.DataStrings("teamId"))
+	assert.Equal(t, []string{"a"}, auth.DataStrings("mixed"))
+	assert.Nil(t, auth.DataStrings("count"))
+	assert.Nil(t, auth.DataStrings("unknown"))
+
+	var data struct {
+		UserIds []string `json:"userIds"`
+		TeamId  string   `json:"teamId"`
+		Count   int      `json:"count"`
+	}
+	assert.Nil(t, auth.DecodeData(&data))
+	assert.Equal(t, []string{"00004", "00005"}, data.UserIds)
+	assert.Equal(t, "team-1", data.TeamId)
+	assert.Equal(t, 2, data.Count)
+
+	var wrongType struct {
+		TeamId int `json:"teamId"`
+	}
+	assert.NotNil(t, auth.DecodeData(&wrongType))
+}
+
+func TestAuthorization_UndefinedResult(t *testing.T) {
+	var undefined Authorization
+	assert.Nil(t, json.Unmarshal([]byte(`{}`), &undefined))
+
+	for _, auth := range []*Authorization{nil, &undefined} {
+		assert.False(t, auth.IsAuthorized())
+		assert.Equal(t, "", auth.Route())
+		assert.Nil(t, auth.DataStrings("userIds"))
+		data := map[string]interface{}{"untouched": true}
+		assert.Nil(t, auth.DecodeData(&data))
+		assert.Equal(t, map[string]interface{}{"untouched": true}, data)
+	}
+}
+
+func TestNewAuthorization(t *testing.T) {
+	auth := NewAuthorization(true, "tidewhisperer-get", map[string]interface{}{"userIds": []string{"00004"}})
+	assert.True(t, auth.IsAuthorized())
+	assert.Equal(t, []string{"00004"}, auth.DataStrings("userIds"))
+	assert.Equal(t, *auth, NewMock().GetMockedAuth(true, map[string]interface{}{"userIds": []string{"00004"}}, "tidewhisperer-get"))
+}
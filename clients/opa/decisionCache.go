@@ -0,0 +1,156 @@
+package opa
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mdblp/go-common/v2/internal/lru"
+)
+
+// DefaultVolatileHeaders are the request headers which change between two identical requests,
+// they are ignored in the key of the decision cache
+var DefaultVolatileHeaders = []string{
+	"accept-encoding",
+	"connection",
+	"content-length",
+	"date",
+	"traceparent",
+	"tracestate",
+	"x-amzn-trace-id",
+	"x-forwarded-for",
+	"x-real-ip",
+	"x-request-id",
+	"x-tidepool-trace-session",
+}
+
+// DecisionCacheConfig configures the decision cache of the OPA client
+type DecisionCacheConfig struct {
+	// Size is the maximum number of cached decisions
+	Size int
+	// AllowTTL and DenyTTL are how long the authorized and the denied decisions are cached, a decision is not cached with 0
+	AllowTTL time.Duration
+	DenyTTL  time.Duration
+	// VolatileHeaders are ignored in the cache key (case insensitive), defaults to DefaultVolatileHeaders
+	VolatileHeaders []string
+}
+
+// DecisionCacheStats are the metrics of the decision cache of the OPA client
+type DecisionCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the current number of cached decisions
+	Size int
+}
+
+type decisionCache struct {
+	config          DecisionCacheConfig
+	volatileHeaders map[string]bool
+	decisions       *lru.Cache[[sha256.Size]byte, Authorization]
+}
+
+// WithDecisionCache caches the decisions of GetOpaAuth and GetOpaAuthWithContext.
+//
+// Decisions are cached by a hash of the input sent to OPA, without its volatile headers, and of the tokens of the request
+// (TokenHeaders), whether they are sent to OPA or not: only the same request of the same user reuses the decision.
+// The decisions of the requests without token are not cached. Call InvalidateDecisions when the policies change.
+// The data of the cached decisions is shared between the callers, who must not modify it.
+func (client *ClientStruct) WithDecisionCache(config DecisionCacheConfig) *ClientStruct {
+	if config.Size <= 0 || (config.AllowTTL <= 0 && config.DenyTTL <= 0) {
+		client.decisions = nil
+		return client
+	}
+	if config.VolatileHeaders == nil {
+		config.VolatileHeaders = DefaultVolatileHeaders
+	}
+	volatileHeaders := make(map[string]bool, len(config.VolatileHeaders))
+	for _, header := range config.VolatileHeaders {
+		volatileHeaders[strings.ToLower(header)] = true
+	}
+	client.decisions = &decisionCache{
+		config:          config,
+		volatileHeaders: volatileHeaders,
+		decisions:       lru.New[[sha256.Size]byte, Authorization](config.Size),
+	}
+	return client
+}
+
+// InvalidateDecisions removes all the cached decisions, for example when the policies are updated
+func (client *ClientStruct) InvalidateDecisions() {
+	if client.decisions != nil {
+		client.decisions.decisions.Purge()
+	}
+}
+
+// DecisionCacheStats returns the hits, misses and size of the decision cache
+func (client *ClientStruct) DecisionCacheStats() DecisionCacheStats {
+	if client.decisions == nil {
+		return DecisionCacheStats{}
+	}
+	stats := client.decisions.decisions.Stats()
+	return DecisionCacheStats{Hits: stats.Hits, Misses: stats.Misses, Size: stats.Size}
+}
+
+// key returns the canonical hash of an input: its json encoding (whose map keys are sorted) without the volatile headers,
+// followed by the raw tokens of the request. The input may not identify the caller, when the token headers are not sent.
+// There is no key for the requests without identity.
+func (cache *decisionCache) key(input *HTTPInput, req *http.Request) ([sha256.Size]byte, bool) {
+	hash := sha256.New()
+	identified := input.Input.Token != nil
+	for _, header := range TokenHeaders {
+		if value := req.Header.Get(header); value != "" {
+			identified = true
+			fmt.Fprintf(hash, "%s: %s\n", header, value)
+		}
+	}
+	if !identified {
+		return [sha256.Size]byte{}, false
+	}
+
+	canonical := *input
+	canonical.Input.Request.Headers = make(map[string]string, len(input.Input.Request.Headers))
+	for name, value := range input.Input.Request.Headers {
+		if !cache.volatileHeaders[name] {
+			canonical.Input.Request.Headers[name] = value
+		}
+	}
+	encoded, err := json.Marshal(canonical)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	hash.Write(encoded)
+	var key [sha256.Size]byte
+	hash.Sum(key[:0])
+	return key, true
+}
+
+func (cache *decisionCache) get(key [sha256.Size]byte) (*Authorization, bool) {
+	auth, ok := cache.decisions.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return auth.copy(), true
+}
+
+func (cache *decisionCache) add(key [sha256.Size]byte, auth *Authorization) {
+	ttl := cache.config.DenyTTL
+	if auth.IsAuthorized() {
+		ttl = cache.config.AllowTTL
+	}
+	if ttl > 0 {
+		cache.decisions.Add(key, *auth.copy(), time.Now().Add(ttl))
+	}
+}
+
+// copy returns a copy of the authorization and its result, the data is shared
+func (auth *Authorization) copy() *Authorization {
+	result := &Authorization{}
+	if auth.Result != nil {
+		r := *auth.Result
+		result.Result = &r
+	}
+	return result
+}
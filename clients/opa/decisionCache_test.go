@@ -0,0 +1,159 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDecisionServer authorizes the requests of the hcp token, it counts the calls
+func newDecisionServer(t testing.TB) (*httptest.Server, *int32) {
+	var calls int32
+	srvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		var input HTTPInput
+		_ = json.NewDecoder(req.Body).Decode(&input)
+		res.Header().Set("content-type", "application/json")
+		authorized := input.Input.Request.Headers["authorization"] == "Bearer hcp"
+		fmt.Fprintf(res, `{"result": {"authorized": %t, "route": "tidewhisperer-get", "data": {"userIds": ["00004"]}}}`, authorized)
+	}))
+	t.Cleanup(srvr.Close)
+	return srvr, &calls
+}
+
+func newDecisionRequest(token string, traceSession string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://tidewhisperer/v1/data/00004?startDate=2025-10-01", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("x-tidepool-trace-session", traceSession)
+	return req
+}
+
+func TestClientStruct_DecisionCache(t *testing.T) {
+	srvr, calls := newDecisionServer(t)
+	client, _ := NewClient(nil, srvr.URL, "test")
+	client.WithDecisionCache(DecisionCacheConfig{Size: 10, AllowTTL: time.Minute, DenyTTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		auth, err := client.GetOpaAuth(newDecisionRequest("hcp", fmt.Sprintf("trace-%d", i)), nil)
+		assert.Nil(t, err)
+		assert.True(t, auth.IsAuthorized())
+		assert.Equal(t, []string{"00004"}, auth.DataStrings("userIds"))
+		// callers get their own copy
+		auth.Result.Authorized = false
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	assert.Equal(t, DecisionCacheStats{Hits: 2, Misses: 1, Size: 1}, client.DecisionCacheStats())
+
+	t.Run("Caches the denied decisions separately", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			auth, err := client.GetOpaAuth(newDecisionRequest("patient", "trace"), nil)
+			assert.Nil(t, err)
+			assert.False(t, auth.IsAuthorized())
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+	t.Run("The data is part of the key", func(t *testing.T) {
+		_, _ = client.GetOpaAuth(newDecisionRequest("hcp", "trace"), map[string]interface{}{"teamId": "team-1"})
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+	t.Run("Invalidates the decisions", func(t *testing.T) {
+		client.InvalidateDecisions()
+		assert.Equal(t, 0, client.DecisionCacheStats().Size)
+		_, _ = client.GetOpaAuth(newDecisionRequest("hcp", "trace"), nil)
+		assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+	})
+}
+
+func TestClientStruct_DecisionCacheTTL(t *testing.T) {
+	srvr, calls := newDecisionServer(t)
+	client, _ := NewClient(nil, srvr.URL, "test")
+	client.WithDecisionCache(DecisionCacheConfig{Size: 10, AllowTTL: time.Minute, VolatileHeaders: []string{}})
+
+	// denied decisions are not cached without DenyTTL
+	for i := 0; i < 2; i++ {
+		_, _ = client.GetOpaAuth(newDecisionRequest("patient", "trace"), nil)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+
+	// without volatile headers, the trace session is part of the key
+	_, _ = client.GetOpaAuth(newDecisionRequest("hcp", "trace-1"), nil)
+	_, _ = client.GetOpaAuth(newDecisionRequest("hcp", "trace-2"), nil)
+	_, _ = client.GetOpaAuth(newDecisionRequest("hcp", "trace-2"), nil)
+	assert.Equal(t, int32(4), atomic.LoadInt32(calls))
+
+	// a cache without TTL is disabled
+	client.WithDecisionCache(DecisionCacheConfig{Size: 10})
+	assert.Nil(t, client.decisions)
+	assert.Equal(t, DecisionCacheStats{}, client.DecisionCacheStats())
+	client.InvalidateDecisions()
+}
+
+func TestClientStruct_DecisionCacheIdentity(t *testing.T) {
+	srvr, calls := newDecisionServer(t)
+
+	t.Run("Each token has its own decision", func(t *testing.T) {
+		client, _ := NewClient(nil, srvr.URL, "test")
+		client.WithDecisionCache(DecisionCacheConfig{Size: 10, AllowTTL: time.Minute, DenyTTL: time.Minute})
+		for i := 0; i < 2; i++ {
+			auth, err := client.GetOpaAuth(newDecisionRequest("hcp", "trace"), nil)
+			assert.Nil(t, err)
+			assert.True(t, auth.IsAuthorized())
+			auth, err = client.GetOpaAuth(newDecisionRequest("patient", "trace"), nil)
+			assert.Nil(t, err)
+			assert.False(t, auth.IsAuthorized())
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+		assert.Equal(t, DecisionCacheStats{Hits: 2, Misses: 2, Size: 2}, client.DecisionCacheStats())
+	})
+
+	t.Run("The tokens are part of the key when they are not sent", func(t *testing.T) {
+		atomic.StoreInt32(calls, 0)
+		client, _ := NewClient(nil, srvr.URL, "test")
+		client.WithTokenClaims().WithDecisionCache(DecisionCacheConfig{Size: 10, AllowTTL: time.Minute, DenyTTL: time.Minute})
+		for _, token := range []string{"hcp", "patient", "hcp", "patient"} {
+			_, err := client.GetOpaAuth(newDecisionRequest(token, "trace"), nil)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+		assert.Equal(t, 2, client.DecisionCacheStats().Size)
+	})
+	t.Run("Does not cache the decisions of the requests without identity", func(t *testing.T) {
+		atomic.StoreInt32(calls, 0)
+		client, _ := NewClient(nil, srvr.URL, "test")
+		client.WithDecisionCache(DecisionCacheConfig{Size: 10, AllowTTL: time.Minute, DenyTTL: time.Minute})
+		for i := 0; i < 2; i++ {
+			req := newDecisionRequest("", "trace")
+			req.Header.Del("Authorization")
+			_, err := client.GetOpaAuth(req, nil)
+			assert.Nil(t, err)
+		}
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+		assert.Equal(t, 0, client.DecisionCacheStats().Size)
+	})
+}
+
+func BenchmarkClientStruct_GetOpaAuth(b *testing.B) {
+	srvr, _ := newDecisionServer(b)
+	req := newDecisionRequest("hcp", "trace")
+	for _, cacheSize := range []int{0, 1000} {
+		client, _ := NewClient(nil, srvr.URL, "test")
+		client.WithDecisionCache(DecisionCacheConfig{Size: cacheSize, AllowTTL: time.Minute})
+		name := "without cache"
+		if cacheSize > 0 {
+			name = "with cache"
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetOpaAuth(req, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
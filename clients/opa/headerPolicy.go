@@ -0,0 +1,104 @@
+package opa
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mdblp/go-common/v2/context"
+)
+
+// TokenHeaders are the headers carrying the authentication tokens. They are sent to OPA by default, as the existing
+// policies read the caller identity from them: use WithTokenClaims to send the decoded claims instead,
+// so that no raw token ends up in the OPA decision logs.
+var TokenHeaders = []string{"authorization", "x-tidepool-session-token"}
+
+// DefaultDeniedHeaders are the credentials never sent to OPA, whatever the HeaderPolicy, unless HeaderPolicy.SendCredentials is set
+var DefaultDeniedHeaders = []string{"cookie", "proxy-authorization", "x-api-key"}
+
+// HeaderPolicy selects the request headers sent to OPA, which end up in the OPA decision logs.
+// Header names are case insensitive.
+type HeaderPolicy struct {
+	// Allowed, when not empty, are the only headers sent
+	Allowed []string
+	// Denied headers are never sent, even when allowed. They are added to the DefaultDeniedHeaders.
+	Denied []string
+	// SendCredentials sends the DefaultDeniedHeaders, when the policy does not deny them
+	SendCredentials bool
+}
+
+// TokenClaims are the claims of the authentication token of the request, sent to OPA with WithTokenClaims
+type TokenClaims struct {
+	UserId   string `json:"userId"`
+	Role     string `json:"role"`
+	IsServer bool   `json:"isServer"`
+}
+
+type headerFilter struct {
+	allowed map[string]bool
+	denied  map[string]bool
+}
+
+func newHeaderFilter(policy HeaderPolicy, denied ...[]string) headerFilter {
+	filter := headerFilter{allowed: lowerSet(policy.Allowed), denied: lowerSet(policy.Denied)}
+	for _, headers := range denied {
+		for _, header := range headers {
+			filter.denied[strings.ToLower(header)] = true
+		}
+	}
+	return filter
+}
+
+func lowerSet(headers []string) map[string]bool {
+	set := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		set[strings.ToLower(header)] = true
+	}
+	return set
+}
+
+// keep tells whether a header, whose name is lower case, is sent to OPA
+func (f headerFilter) keep(header string) bool {
+	if f.denied[header] {
+		return false
+	}
+	return len(f.allowed) == 0 || f.allowed[header]
+}
+
+// WithHeaderPolicy selects the headers sent to OPA. By default, every header but the DefaultDeniedHeaders is sent.
+func (client *ClientStruct) WithHeaderPolicy(policy HeaderPolicy) *ClientStruct {
+	client.headerPolicy = policy
+	client.headerFilter = client.newHeaderFilter()
+	return client
+}
+
+// WithTokenClaims sends the claims of the authentication token (input.token) instead of the token headers (TokenHeaders),
+// so that no raw token ends up in the OPA decision logs. The claims are read from the context of the request,
+// where they are set by the auth middleware (see context.GetTokenData). input.token is not set without claims.
+func (client *ClientStruct) WithTokenClaims() *ClientStruct {
+	client.sendTokenClaims = true
+	client.headerFilter = client.newHeaderFilter()
+	return client
+}
+
+func (client *ClientStruct) newHeaderFilter() headerFilter {
+	var denied [][]string
+	if !client.headerPolicy.SendCredentials {
+		denied = append(denied, DefaultDeniedHeaders)
+	}
+	if client.sendTokenClaims {
+		denied = append(denied, TokenHeaders)
+	}
+	return newHeaderFilter(client.headerPolicy, denied...)
+}
+
+// tokenClaims returns the claims of the token of the request, when they are sent to OPA
+func (client *ClientStruct) tokenClaims(req *http.Request) *TokenClaims {
+	if !client.sendTokenClaims {
+		return nil
+	}
+	tokenData, ok := context.GetTokenData(req.Context())
+	if !ok {
+		return nil
+	}
+	return &TokenClaims{UserId: tokenData.UserId, Role: tokenData.Role, IsServer: tokenData.IsServer}
+}
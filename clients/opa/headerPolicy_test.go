@@ -0,0 +1,97 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dblcontext "github.com/mdblp/go-common/v2/context"
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderPolicy(t *testing.T) {
+	var received HTTPInput
+	srvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received = HTTPInput{}
+		_ = json.NewDecoder(req.Body).Decode(&received)
+		res.Header().Set("content-type", "application/json")
+		fmt.Fprint(res, `{"result": {"authorized": true, "route": "tidewhisperer-get"}}`)
+	}))
+	defer srvr.Close()
+
+	newRequest := func(ctx context.Context) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://authorized/data", nil).WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer some.jwt.token")
+		req.Header.Set("X-Tidepool-Session-Token", "session-token")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("X-Api-Key", "key")
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("User-Agent", "test")
+		return req
+	}
+
+	t.Run("Drops the default denied headers", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		_, err := opaClient.GetOpaAuth(newRequest(context.Background()), nil)
+		assert.Nil(t, err)
+		headers := received.Input.Request.Headers
+		assert.NotContains(t, headers, "cookie")
+		assert.NotContains(t, headers, "x-api-key")
+		assert.Equal(t, "Bearer some.jwt.token", headers["authorization"])
+		assert.Equal(t, "session-token", headers["x-tidepool-session-token"])
+		assert.Equal(t, "10.0.0.1", headers["x-forwarded-for"])
+		assert.Nil(t, received.Input.Token)
+	})
+	t.Run("Drops the denied headers", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		opaClient.WithHeaderPolicy(HeaderPolicy{Denied: []string{"User-Agent"}})
+		_, err := opaClient.GetOpaAuth(newRequest(context.Background()), nil)
+		assert.Nil(t, err)
+		headers := received.Input.Request.Headers
+		assert.NotContains(t, headers, "user-agent")
+		// on top of the default ones
+		assert.NotContains(t, headers, "cookie")
+		assert.NotContains(t, headers, "x-api-key")
+		assert.Equal(t, "Bearer some.jwt.token", headers["authorization"])
+	})
+	t.Run("Sends the credentials on demand", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		opaClient.WithHeaderPolicy(HeaderPolicy{Denied: []string{"x-api-key"}, SendCredentials: true})
+		_, err := opaClient.GetOpaAuth(newRequest(context.Background()), nil)
+		assert.Nil(t, err)
+		headers := received.Input.Request.Headers
+		assert.Equal(t, "session=secret", headers["cookie"])
+		assert.NotContains(t, headers, "x-api-key")
+	})
+	t.Run("Only sends the allowed headers", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		opaClient.WithHeaderPolicy(HeaderPolicy{Allowed: []string{"X-Forwarded-For", "cookie"}, Denied: []string{"Cookie"}})
+		_, err := opaClient.GetOpaAuth(newRequest(context.Background()), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"x-forwarded-for": "10.0.0.1"}, received.Input.Request.Headers)
+	})
+	t.Run("Sends the token claims instead of the token headers", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		opaClient.WithTokenClaims()
+		ctx := dblcontext.SetTokenData(context.Background(), &token.TokenData{UserId: "123456", Role: "hcp"})
+		_, err := opaClient.GetOpaAuth(newRequest(ctx), nil)
+		assert.Nil(t, err)
+		headers := received.Input.Request.Headers
+		assert.NotContains(t, headers, "authorization")
+		assert.NotContains(t, headers, "x-tidepool-session-token")
+		assert.NotContains(t, headers, "cookie")
+		assert.Equal(t, &TokenClaims{UserId: "123456", Role: "hcp", IsServer: false}, received.Input.Token)
+	})
+	t.Run("Sends no token claims without token data in the context", func(t *testing.T) {
+		opaClient, _ := NewClient(nil, srvr.URL, "test")
+		opaClient.WithTokenClaims()
+		_, err := opaClient.GetOpaAuth(newRequest(context.Background()), nil)
+		assert.Nil(t, err)
+		assert.Nil(t, received.Input.Token)
+		assert.NotContains(t, received.Input.Request.Headers, "authorization")
+	})
+}
@@ -1,16 +1,16 @@
 package opa
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	URL "net/url"
 	"os"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/mdblp/go-common/v2/clients/status"
 )
@@ -18,6 +18,7 @@ import (
 // Client is the interface to opa.
 type Client interface {
 	GetOpaAuth(req *http.Request, data map[string]interface{}) (*Authorization, error)
+	GetOpaAuthWithContext(ctx context.Context, req *http.Request, data map[string]interface{}) (*Authorization, error)
 }
 
 // ClientStruct used to store infos for this API
@@ -25,22 +26,34 @@ type ClientStruct struct {
 	host              string
 	requestingService string
 	httpClient        *http.Client
+	timeout           time.Duration
+	// decisions is the optional decision cache
+	decisions *decisionCache
+	// selection of the headers and token claims sent to OPA
+	headerPolicy    HeaderPolicy
+	headerFilter    headerFilter
+	sendTokenClaims bool
 }
 
 // Authorization struct for authz
-// "result": {
-//     "authorized": false,
-//     "data": {
-//         "userIds": [
-//             "00004"
-//         ]
-//     },
-//     "route": "tidewhisperer-get"
-// }
+//
+//	"result": {
+//	    "authorized": false,
+//	    "data": {
+//	        "userIds": [
+//	            "00004"
+//	        ]
+//	    },
+//	    "route": "tidewhisperer-get"
+//	}
+//
+// Result is nil when the policy is undefined, use the nil-safe accessors (IsAuthorized, Route...) to read it.
 type Authorization struct {
-	Result *opaResult `json:"result"`
+	Result *Result `json:"result"`
 }
-type opaResult struct {
+
+// Result is the decision of the OPA policy
+type Result struct {
 	Authorized bool                   `json:"authorized"`
 	Data       map[string]interface{} `json:"data"`
 	Route      string                 `json:"route"`
@@ -60,11 +73,15 @@ type HTTPInput struct {
 			Service  string            `json:"service"`
 		} `json:"request"`
 		Data map[string]interface{} `json:"data,omitempty"`
+		// Token is only sent with WithTokenClaims
+		Token *TokenClaims `json:"token,omitempty"`
 	} `json:"input"`
 }
 
 const (
 	routeAuth = "/v1/data/backloops/access"
+	// policyAuth is routeAuth relative to the OPA Data API
+	policyAuth = "backloops/access"
 )
 
 // NewClient create a new OPA client with the specified host & service
@@ -89,6 +106,7 @@ func NewClient(httpClient *http.Client, host string, service string) (*ClientStr
 		host:              host,
 		requestingService: service,
 		httpClient:        client,
+		headerFilter:      newHeaderFilter(HeaderPolicy{}, DefaultDeniedHeaders),
 	}, nil
 }
 
@@ -118,7 +136,9 @@ func (client *ClientStruct) formatRequest(req *http.Request, data map[string]int
 	url := *req.URL
 	headers := make(map[string]string)
 	for k := range req.Header {
-		headers[strings.ToLower(k)] = req.Header.Get(k)
+		if name := strings.ToLower(k); client.headerFilter.keep(name) {
+			headers[name] = req.Header.Get(k)
+		}
 	}
 	if decodedString, err = URL.QueryUnescape(url.RawQuery); err != nil {
 		return nil, fmt.Errorf("Unable to parse query String [%s]", err)
@@ -134,46 +154,50 @@ func (client *ClientStruct) formatRequest(req *http.Request, data map[string]int
 	opaReq.Input.Request.Fragment = url.RawFragment
 	opaReq.Input.Request.Service = client.requestingService
 	opaReq.Input.Data = data
+	opaReq.Input.Token = client.tokenClaims(req)
 	return &opaReq, nil
 }
 
 // GetOpaAuth Return the patient configuration
 //
 // The token parameter is used to identify the patient.
+// The call is bound to the context of req, use GetOpaAuthWithContext to bind it to another context.
 func (client *ClientStruct) GetOpaAuth(req *http.Request, data map[string]interface{}) (*Authorization, error) {
-	var jsonRequest []byte
-	var err error
-	host, err := url.Parse(client.host)
-	if host == nil || err != nil {
-		return nil, err
-	}
+	return client.GetOpaAuthWithContext(req.Context(), req, data)
+}
 
-	host.Path = path.Join(host.Path, routeAuth)
-	myRequest, _ := client.formatRequest(req, data)
-	if jsonRequest, err = json.Marshal(*myRequest); err != nil {
+// GetOpaAuthWithContext asks OPA whether req is authorized, like GetOpaAuth.
+//
+// The call is cancelled with ctx, and bounded by the timeout of the client (see WithTimeout).
+// The trace session id of ctx (see context.GetTraceSessionId) is forwarded to OPA.
+func (client *ClientStruct) GetOpaAuthWithContext(ctx context.Context, req *http.Request, data map[string]interface{}) (*Authorization, error) {
+	opaReq, err := client.formatRequest(req, data)
+	if err != nil {
 		return nil, &status.StatusError{
 			Status: status.NewStatusf(http.StatusInternalServerError, "Error formatting request [%s]", err.Error()),
 		}
 	}
-	req, err = http.NewRequest("POST", host.String(), bytes.NewBuffer(jsonRequest))
-	if err != nil {
-		return nil, err
+	var cacheKey [sha256.Size]byte
+	cacheable := false
+	if client.decisions != nil {
+		if cacheKey, cacheable = client.decisions.key(opaReq, req); cacheable {
+			if auth, ok := client.decisions.get(cacheKey); ok {
+				return auth, nil
+			}
+		}
 	}
-
-	res, err := client.httpClient.Do(req)
-	if err != nil {
+	var auth Authorization
+	if _, err := client.Query(ctx, policyAuth, opaReq.Input, &auth.Result); err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Unknown response code[%d] from service[%s]", res.StatusCode, req.URL)
+	if cacheable {
+		client.decisions.add(cacheKey, &auth)
 	}
-
-	var auth Authorization
-	if err = json.NewDecoder(res.Body).Decode(&auth); err != nil {
-		return nil, fmt.Errorf("Error parsing JSON results: %v", err)
-	}
-
 	return &auth, nil
 }
+
+// WithTimeout bounds the duration of the calls to OPA, on top of the deadline of their context
+func (client *ClientStruct) WithTimeout(timeout time.Duration) *ClientStruct {
+	client.timeout = timeout
+	return client
+}
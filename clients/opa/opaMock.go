@@ -1,6 +1,7 @@
 package opa
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
@@ -11,7 +12,6 @@ type opaAuthCall struct {
 }
 
 // MockClient The mocked interface to portal-api.
-//
 type MockClient struct {
 	nextOpaAuthCall map[string]*opaAuthCall
 }
@@ -37,10 +37,12 @@ func (client *MockClient) SetMockOpaAuth(key string, auth *Authorization, err er
 	}
 }
 
-//GetMockedAuth returns Authorization struct from external packages (opaResult stuct is "private")
+// GetMockedAuth returns an Authorization with the given result
+//
+// Deprecated: the Result type is exported, build the Authorization directly or use NewAuthorization
 func (client *MockClient) GetMockedAuth(authorized bool, data map[string]interface{}, route string) Authorization {
 	return Authorization{
-		Result: &opaResult{
+		Result: &Result{
 			Authorized: authorized,
 			Data:       data,
 			Route:      route,
@@ -57,3 +59,8 @@ func (client *MockClient) GetOpaAuth(req *http.Request, data map[string]interfac
 	}
 	return pcc.auth, pcc.err
 }
+
+// GetOpaAuthWithContext mock the GetOpaAuthWithContext call, like GetOpaAuth
+func (client *MockClient) GetOpaAuthWithContext(ctx context.Context, req *http.Request, data map[string]interface{}) (*Authorization, error) {
+	return client.GetOpaAuth(req, data)
+}
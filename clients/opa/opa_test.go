@@ -1,12 +1,19 @@
 package opa
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	dblcontext "github.com/mdblp/go-common/v2/context"
+	"github.com/mdblp/go-common/v2/http/request"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetOpaAuth(t *testing.T) {
@@ -96,4 +103,64 @@ func TestGetOpaAuth(t *testing.T) {
 		t.Errorf("Failed GetOpaAuth expected an error")
 		return
 	}
+	if stackErr, ok := err.(blperr.StackError); !ok || stackErr.Kind() != request.KindForbidden {
+		t.Errorf("Failed GetOpaAuth expected a forbidden error, got [%v]", err)
+	}
+}
+
+func TestGetOpaAuthWithContext(t *testing.T) {
+	var receivedTraceId string
+	release := make(chan struct{})
+	srvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var input HTTPInput
+		_ = json.NewDecoder(req.Body).Decode(&input)
+		if input.Input.Request.Host == "hanging" {
+			select {
+			case <-release:
+			case <-req.Context().Done():
+			}
+			return
+		}
+		receivedTraceId = req.Header.Get(dblcontext.TRACE_SESSION_HEADER)
+		res.Header().Set("content-type", "application/json")
+		fmt.Fprint(res, `{"result": {"authorized": true, "route": "tidewhisperer-get"}}`)
+	}))
+	defer srvr.Close()
+	defer close(release)
+	opaClient, _ := NewClient(nil, srvr.URL, "test")
+
+	t.Run("Forwards the trace session id", func(t *testing.T) {
+		ctx := dblcontext.SetTraceSessionId(context.Background(), "4b1ab1b4-7c0f-4b39-9d8a-6c3b7e7e4a11")
+		auth, err := opaClient.GetOpaAuthWithContext(ctx, httptest.NewRequest(http.MethodGet, "http://authorized/data", nil), nil)
+		assert.Nil(t, err)
+		assert.True(t, auth.IsAuthorized())
+		assert.Equal(t, "4b1ab1b4-7c0f-4b39-9d8a-6c3b7e7e4a11", receivedTraceId)
+	})
+	t.Run("Honours the deadline of the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := opaClient.GetOpaAuthWithContext(ctx, httptest.NewRequest(http.MethodGet, "http://hanging/data", nil), nil)
+		assert.NotNil(t, err)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+	t.Run("Honours the timeout of the client", func(t *testing.T) {
+		timeoutClient, _ := NewClient(nil, srvr.URL, "test")
+		timeoutClient.WithTimeout(50 * time.Millisecond)
+		start := time.Now()
+		_, err := timeoutClient.GetOpaAuth(httptest.NewRequest(http.MethodGet, "http://hanging/data", nil), nil)
+		assert.NotNil(t, err)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+	t.Run("Returns an undefined authorization", func(t *testing.T) {
+		emptySrvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(res, `{}`)
+		}))
+		defer emptySrvr.Close()
+		emptyClient, _ := NewClient(nil, emptySrvr.URL, "test")
+		auth, err := emptyClient.GetOpaAuthWithContext(context.Background(), httptest.NewRequest(http.MethodGet, "http://authorized/data", nil), nil)
+		assert.Nil(t, err)
+		assert.Nil(t, auth.Result)
+		assert.False(t, auth.IsAuthorized())
+	})
 }
@@ -0,0 +1,138 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mdblp/go-common/v2/http/request"
+)
+
+// PolicyClient queries any policy package of OPA, GetOpaAuth being limited to the backloops/access decision
+type PolicyClient interface {
+	Query(ctx context.Context, policyPath string, input interface{}, out interface{}, opts ...QueryOption) (*QueryResponse, error)
+	Compile(ctx context.Context, compileRequest CompileRequest, opts ...QueryOption) (*CompileResponse, error)
+}
+
+// Explain modes of the OPA Data and Compile APIs
+const (
+	ExplainNotes = "notes"
+	ExplainFails = "fails"
+	ExplainFull  = "full"
+	ExplainDebug = "debug"
+)
+
+// QueryOption adds a query parameter to the calls of the OPA Data and Compile APIs
+type QueryOption func(b *request.RequestBuilder)
+
+// WithExplain returns the trace of the evaluation (ExplainNotes, ExplainFails, ExplainFull or ExplainDebug)
+func WithExplain(mode string) QueryOption {
+	return func(b *request.RequestBuilder) {
+		b.WithQueryParam("explain", mode)
+	}
+}
+
+// WithMetrics returns the performance metrics of the evaluation
+func WithMetrics() QueryOption {
+	return func(b *request.RequestBuilder) {
+		b.WithQueryParam("metrics", true)
+	}
+}
+
+// WithProvenance returns the build and bundles information of the OPA instance
+func WithProvenance() QueryOption {
+	return func(b *request.RequestBuilder) {
+		b.WithQueryParam("provenance", true)
+	}
+}
+
+// QueryResponse holds the information returned by OPA along with the result of a query
+type QueryResponse struct {
+	// Defined is false when the policy has no result for the input, out is then left unchanged
+	Defined    bool   `json:"-"`
+	DecisionID string `json:"decision_id,omitempty"`
+	// Metrics, Explanation and Provenance are only returned with the matching QueryOption
+	Metrics     map[string]interface{} `json:"metrics,omitempty"`
+	Explanation json.RawMessage        `json:"explanation,omitempty"`
+	Provenance  json.RawMessage        `json:"provenance,omitempty"`
+}
+
+type queryResponse struct {
+	QueryResponse
+	Result json.RawMessage `json:"result"`
+}
+
+// CompileRequest is a partial evaluation request, see https://www.openpolicyagent.org/docs/latest/rest-api/#compile-api
+type CompileRequest struct {
+	// Query to partially evaluate, for example "data.backloops.access.authorized == true"
+	Query string `json:"query"`
+	// Input is the known part of the input
+	Input interface{} `json:"input,omitempty"`
+	// Unknowns are the references left unknown, for example "input.resource"
+	Unknowns []string `json:"unknowns,omitempty"`
+}
+
+// CompileResponse is the result of a partial evaluation.
+//
+// With no query, the query is never true. With an empty query, it is always true.
+// Otherwise, it is true when one of the queries is, the queries being the remaining conditions on the unknowns.
+type CompileResponse struct {
+	Result struct {
+		Queries []json.RawMessage `json:"queries,omitempty"`
+		Support []json.RawMessage `json:"support,omitempty"`
+	} `json:"result"`
+	Metrics     map[string]interface{} `json:"metrics,omitempty"`
+	Explanation json.RawMessage        `json:"explanation,omitempty"`
+}
+
+// Query evaluates a policy with the OPA Data API and decodes its result into out.
+//
+// policyPath is the path of the policy package or rule, relative to /v1/data, for example "backloops/access".
+// An empty path ("" or "/") queries the root document.
+func (client *ClientStruct) Query(ctx context.Context, policyPath string, input interface{}, out interface{}, opts ...QueryOption) (*QueryResponse, error) {
+	payload := map[string]interface{}{}
+	if input != nil {
+		payload["input"] = input
+	}
+	path := []string{"v1/data"}
+	if policyPath = strings.Trim(policyPath, "/"); policyPath != "" {
+		path = append(path, policyPath)
+	}
+	builder := request.NewPostBuilder(client.host).
+		WithPath(path...).
+		WithPayload(payload).
+		WithTimeout(client.timeout)
+	for _, opt := range opts {
+		opt(builder)
+	}
+
+	var response queryResponse
+	if _, err := builder.Do(ctx, client.httpClient, &response); err != nil {
+		return nil, err
+	}
+	response.Defined = len(response.Result) > 0 && string(response.Result) != "null"
+	if response.Defined && out != nil {
+		if err := json.Unmarshal(response.Result, out); err != nil {
+			return nil, fmt.Errorf("Error parsing the result of policy [%s]: %w", policyPath, err)
+		}
+	}
+	return &response.QueryResponse, nil
+}
+
+// Compile partially evaluates a query with the OPA Compile API
+func (client *ClientStruct) Compile(ctx context.Context, compileRequest CompileRequest, opts ...QueryOption) (*CompileResponse, error) {
+	builder := request.NewPostBuilder(client.host).
+		WithPath("v1/compile").
+		WithPayload(compileRequest).
+		WithTimeout(client.timeout)
+	for _, opt := range opts {
+		opt(builder)
+	}
+
+	var response CompileResponse
+	if _, err := builder.Do(ctx, client.httpClient, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
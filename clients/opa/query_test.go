@@ -0,0 +1,117 @@
+package opa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/http/request"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientStruct_Query(t *testing.T) {
+	var receivedBody map[string]interface{}
+	var receivedQuery string
+	srvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		receivedQuery = req.URL.RawQuery
+		receivedBody = nil
+		_ = json.NewDecoder(req.Body).Decode(&receivedBody)
+		res.Header().Set("content-type", "application/json")
+		switch req.URL.Path {
+		case "/v1/data":
+			fmt.Fprint(res, `{"result": {"teams": {"membership": {"allow": false}}}}`)
+		case "/v1/data/teams/membership":
+			fmt.Fprint(res, `{"result": {"allow": true, "teams": ["team-1"]}, "decision_id": "1234", "metrics": {"timer_rego_query_eval_ns": 1200}}`)
+		case "/v1/data/teams/undefined":
+			fmt.Fprint(res, `{"decision_id": "5678"}`)
+		case "/v1/data/teams/broken":
+			res.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(res, `{"code": "internal_error", "message": "policy error"}`)
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srvr.Close()
+	client, _ := NewClient(nil, srvr.URL, "test")
+	var _ PolicyClient = client
+
+	t.Run("Decodes the result", func(t *testing.T) {
+		var out struct {
+			Allow bool     `json:"allow"`
+			Teams []string `json:"teams"`
+		}
+		response, err := client.Query(context.TODO(), "/teams/membership", map[string]string{"userId": "00004"}, &out, WithMetrics())
+		assert.Nil(t, err)
+		assert.True(t, response.Defined)
+		assert.Equal(t, "1234", response.DecisionID)
+		assert.Equal(t, float64(1200), response.Metrics["timer_rego_query_eval_ns"])
+		assert.True(t, out.Allow)
+		assert.Equal(t, []string{"team-1"}, out.Teams)
+		assert.Equal(t, map[string]interface{}{"input": map[string]interface{}{"userId": "00004"}}, receivedBody)
+		assert.Equal(t, "metrics=true", receivedQuery)
+	})
+	t.Run("Sends the options", func(t *testing.T) {
+		_, err := client.Query(context.TODO(), "teams/membership", nil, nil, WithExplain(ExplainFull), WithMetrics(), WithProvenance())
+		assert.Nil(t, err)
+		assert.Equal(t, "explain=full&metrics=true&provenance=true", receivedQuery)
+		assert.Equal(t, map[string]interface{}{}, receivedBody)
+	})
+	t.Run("Leaves out unchanged when the result is undefined", func(t *testing.T) {
+		out := map[string]interface{}{"untouched": true}
+		response, err := client.Query(context.TODO(), "teams/undefined", nil, &out)
+		assert.Nil(t, err)
+		assert.False(t, response.Defined)
+		assert.Equal(t, "5678", response.DecisionID)
+		assert.Equal(t, map[string]interface{}{"untouched": true}, out)
+	})
+	t.Run("Returns the OPA errors", func(t *testing.T) {
+		_, err := client.Query(context.TODO(), "teams/broken", nil, nil)
+		assert.Equal(t, request.KindServerError, err.(blperr.StackError).Kind())
+	})
+	t.Run("Queries the root document", func(t *testing.T) {
+		for _, policyPath := range []string{"", "/"} {
+			var out map[string]interface{}
+			response, err := client.Query(context.TODO(), policyPath, nil, &out)
+			assert.Nil(t, err)
+			assert.True(t, response.Defined)
+			assert.Contains(t, out, "teams")
+		}
+	})
+	t.Run("Rejects invalid policy paths", func(t *testing.T) {
+		_, err := client.Query(context.TODO(), "teams/../admin", nil, nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func TestClientStruct_Compile(t *testing.T) {
+	var receivedBody map[string]interface{}
+	srvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/compile" {
+			res.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(req.Body).Decode(&receivedBody)
+		res.Header().Set("content-type", "application/json")
+		fmt.Fprint(res, `{"result": {"queries": [[{"index": 0, "terms": []}], []]}}`)
+	}))
+	defer srvr.Close()
+	client, _ := NewClient(nil, srvr.URL, "test")
+
+	response, err := client.Compile(context.TODO(), CompileRequest{
+		Query:    "data.teams.allow == true",
+		Input:    map[string]string{"userId": "00004"},
+		Unknowns: []string{"input.team"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, response.Result.Queries, 2)
+	assert.JSONEq(t, `[]`, string(response.Result.Queries[1]))
+	assert.Equal(t, map[string]interface{}{
+		"query":    "data.teams.allow == true",
+		"input":    map[string]interface{}{"userId": "00004"},
+		"unknowns": []interface{}{"input.team"},
+	}, receivedBody)
+}
@@ -0,0 +1,34 @@
+package clients
+
+import "sync"
+
+// RefreshingTokenProvider caches the token returned by a fetch function and fetches a new one when it is refreshed.
+// It is safe for concurrent use.
+type RefreshingTokenProvider struct {
+	mu    sync.Mutex
+	fetch func() string
+	token string
+}
+
+// NewRefreshingTokenProvider creates a RefreshingTokenProvider, fetch is called to get the first token and on each refresh
+func NewRefreshingTokenProvider(fetch func() string) *RefreshingTokenProvider {
+	return &RefreshingTokenProvider{fetch: fetch}
+}
+
+// TokenProvide returns the cached token, fetching it when there is none
+func (p *RefreshingTokenProvider) TokenProvide() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.token == "" {
+		p.token = p.fetch()
+	}
+	return p.token
+}
+
+// RefreshToken discards the cached token and fetches a new one
+func (p *RefreshingTokenProvider) RefreshToken() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.token = p.fetch()
+	return p.token
+}
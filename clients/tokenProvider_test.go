@@ -0,0 +1,24 @@
+package clients
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshingTokenProvider(t *testing.T) {
+	calls := 0
+	provider := NewRefreshingTokenProvider(func() string {
+		calls++
+		return fmt.Sprintf("token-%d", calls)
+	})
+
+	assert.Equal(t, "token-1", provider.TokenProvide())
+	assert.Equal(t, "token-1", provider.TokenProvide())
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, "token-2", provider.RefreshToken())
+	assert.Equal(t, "token-2", provider.TokenProvide())
+	assert.Equal(t, 2, calls)
+}
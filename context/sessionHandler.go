@@ -6,13 +6,17 @@ import (
 	"regexp"
 
 	"github.com/google/uuid"
+	"github.com/mdblp/shoreline/token"
 )
 
 var TRACE_SESSION_HEADER = "x-tidepool-trace-session"
 
 type traceSessionKeyType int
 
-const traceSessionKey traceSessionKeyType = iota + 1
+const (
+	traceSessionKey traceSessionKeyType = iota + 1
+	tokenDataKey
+)
 
 // Return the trace session id from the context
 func GetTraceSessionId(ctx context.Context) (string, bool) {
@@ -36,6 +40,41 @@ func SetTraceSessionId(ctx context.Context, traceSessionId string) context.Conte
 	return context.WithValue(ctx, traceSessionKey, traceSessionId)
 }
 
+// SetTokenData set the data of the authentication token of the request in the context
+func SetTokenData(ctx context.Context, tokenData *token.TokenData) context.Context {
+	return context.WithValue(ctx, tokenDataKey, tokenData)
+}
+
+// Return the data of the authentication token from the context, set by the auth middleware
+func GetTokenData(ctx context.Context) (*token.TokenData, bool) {
+	tokenData, ok := ctx.Value(tokenDataKey).(*token.TokenData)
+	return tokenData, ok && tokenData != nil
+}
+
+// Return the id of the authenticated user (or client for the server tokens) from the context
+func GetUserId(ctx context.Context) (string, bool) {
+	tokenData, ok := GetTokenData(ctx)
+	if !ok {
+		return "", false
+	}
+	return tokenData.UserId, true
+}
+
+// Return the role of the authenticated user from the context
+func GetRole(ctx context.Context) (string, bool) {
+	tokenData, ok := GetTokenData(ctx)
+	if !ok {
+		return "", false
+	}
+	return tokenData.Role, true
+}
+
+// IsServerToken tells whether the request was authenticated with a server token
+func IsServerToken(ctx context.Context) bool {
+	tokenData, ok := GetTokenData(ctx)
+	return ok && tokenData.IsServer
+}
+
 // Deprecated: SetTraceSessionIdCtx exists for historical compatibility, please use
 // SetTraceSessionIdInRequest instead
 func SetTraceSessionIdCtx(r *http.Request) *http.Request {
@@ -0,0 +1,30 @@
+package context
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mdblp/shoreline/token"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenData(t *testing.T) {
+	ctx := context.Background()
+	_, ok := GetTokenData(ctx)
+	assert.False(t, ok)
+	_, ok = GetUserId(ctx)
+	assert.False(t, ok)
+	assert.False(t, IsServerToken(ctx))
+
+	ctx = SetTokenData(ctx, &token.TokenData{UserId: "123", Role: "hcp", IsServer: true})
+	userId, ok := GetUserId(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "123", userId)
+	role, ok := GetRole(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "hcp", role)
+	assert.True(t, IsServerToken(ctx))
+
+	_, ok = GetTokenData(SetTokenData(context.Background(), nil))
+	assert.False(t, ok)
+}
@@ -0,0 +1,202 @@
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients"
+)
+
+const executorErrorKind = "request-executor"
+
+// RetryPolicy describes how a request is retried by Do
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts (first call included).
+	// When the context has a deadline, retries also stop as soon as the next attempt cannot start before it.
+	MaxAttempts int
+	// InitialBackoff is the base wait duration before the first retry, it doubles on each retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait duration between two attempts.
+	// Retries stop when the server asks (Retry-After) to wait longer than MaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used by Do when no policy is provided with WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// NoRetry disables the retries done by Do
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+// WithRetryPolicy overrides the retry policy used by Do
+func (b *RequestBuilder) WithRetryPolicy(policy RetryPolicy) *RequestBuilder {
+	b.retryPolicy = &policy
+	return b
+}
+
+// Do builds the request, sends it with the provided client and decodes the JSON response body in out.
+// out can be nil when the response body is not needed.
+//
+// Requests with an idempotent method (GET, HEAD, OPTIONS, TRACE, PUT, DELETE) and a replayable body are retried on network errors,
+// 5xx and 429 responses with an exponential backoff (with jitter), up to MaxAttempts attempts. The Retry-After header sent by
+// the server is honoured up to MaxBackoff, the response is returned when the server asks to wait longer.
+// When ctx has a deadline, no attempt is started if it cannot begin before the deadline.
+//
+// When the token is given by a clients.RefreshableTokenProvider, a 401 response triggers a token refresh
+// and the request is sent again once with the new token.
+//
+// The returned response can be used to read the status and the headers, its body is already consumed and closed.
+func (b *RequestBuilder) Do(ctx context.Context, client *http.Client, out interface{}) (*http.Response, error) {
+	policy := DefaultRetryPolicy
+	if b.retryPolicy != nil {
+		policy = *b.retryPolicy
+	}
+	replayable := b.body == nil || b.body.replayable
+	retryable := isIdempotent(b.method) && replayable
+	refreshableProvider, canRefresh := b.tokenProvider.(clients.RefreshableTokenProvider)
+	canRefresh = canRefresh && replayable
+	deadline, hasDeadline := ctx.Deadline()
+
+	for attempt := 1; ; attempt++ {
+		req, cancel, err := b.build(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res, err := send(client, req, cancel)
+		if err == nil && res.StatusCode == http.StatusUnauthorized && canRefresh {
+			// the token may have expired: send the request again, once, with a fresh one
+			canRefresh = false
+			drainAndClose(res)
+			refreshableProvider.RefreshToken()
+			attempt--
+			continue
+		}
+		if err == nil && !isRetryableStatus(res.StatusCode) {
+			return res, decodeResponse(res, out)
+		}
+
+		if ctx.Err() != nil || !retryable || attempt >= policy.MaxAttempts {
+			if err != nil {
+				return nil, executorError("failed to send the http request", req, err)
+			}
+			return res, decodeResponse(res, out)
+		}
+
+		wait := policy.backoff(attempt)
+		tooLong := false
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+				tooLong = retryAfter > policy.MaxBackoff
+			}
+		}
+		if tooLong || (hasDeadline && time.Now().Add(wait).After(deadline)) {
+			if err != nil {
+				return nil, executorError("failed to send the http request", req, err)
+			}
+			return res, decodeResponse(res, out)
+		}
+		if err == nil {
+			drainAndClose(res)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, executorError("failed to send the http request", req, err)
+		}
+	}
+}
+
+func executorError(message string, req *http.Request, err error) blperr.StackError {
+	details := map[string]interface{}{
+		"error":  err.Error(),
+		"method": req.Method,
+		"url":    req.URL.String(),
+	}
+	return blperr.NewWithDetails(executorErrorKind, message, details)
+}
+
+// decodeResponse reads the body of a final response and closes it
+func decodeResponse(res *http.Response, out interface{}) error {
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return NewResponseError(res)
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil && err != io.EOF {
+		return executorError("unable to decode the response body", res.Request, err)
+	}
+	return nil
+}
+
+func drainAndClose(res *http.Response) {
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isRetryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// backoff returns a random duration between 0 and the exponential backoff of the attempt ("full jitter")
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 {
+		return 0
+	}
+	backoff := p.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || (p.MaxBackoff > 0 && backoff > p.MaxBackoff) {
+		backoff = p.MaxBackoff
+	}
+	return time.Duration(rand.Int64N(int64(backoff) + 1))
+}
+
+// parseRetryAfter reads a Retry-After header value, either a number of seconds or an http date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,209 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients"
+)
+
+type profile struct {
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+var fastRetries = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func newFlakyServer(failures int32, failureStatus int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			res.WriteHeader(failureStatus)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(res, `{"firstName":"John","lastName":"Doe"}`)
+	}))
+	return server, &calls
+}
+
+func TestRequestBuilder_Do(t *testing.T) {
+	t.Run("Decodes the json response in the target struct", func(t *testing.T) {
+		server, calls := newFlakyServer(0, http.StatusOK)
+		defer server.Close()
+		var result profile
+		res, err := NewGetBuilder(server.URL).Do(context.TODO(), nil, &result)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, profile{FirstName: "John", LastName: "Doe"}, result)
+		assert.Equal(t, int32(1), *calls)
+	})
+	t.Run("Retries a GET request on 5xx responses", func(t *testing.T) {
+		server, calls := newFlakyServer(2, http.StatusBadGateway)
+		defer server.Close()
+		var result profile
+		_, err := NewGetBuilder(server.URL).WithRetryPolicy(fastRetries).Do(context.TODO(), server.Client(), &result)
+		assert.Nil(t, err)
+		assert.Equal(t, "John", result.FirstName)
+		assert.Equal(t, int32(3), *calls)
+	})
+	t.Run("Stops after the maximum number of attempts", func(t *testing.T) {
+		server, calls := newFlakyServer(5, http.StatusServiceUnavailable)
+		defer server.Close()
+		res, err := NewGetBuilder(server.URL).WithRetryPolicy(fastRetries).Do(context.TODO(), server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, int32(3), *calls)
+	})
+	t.Run("Does not retry a POST request", func(t *testing.T) {
+		server, calls := newFlakyServer(1, http.StatusInternalServerError)
+		defer server.Close()
+		_, err := NewPostBuilder(server.URL).WithPayload("hello").WithRetryPolicy(fastRetries).Do(context.TODO(), server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, int32(1), *calls)
+	})
+	t.Run("Does not retry on 4xx responses", func(t *testing.T) {
+		server, calls := newFlakyServer(1, http.StatusNotFound)
+		defer server.Close()
+		_, err := NewGetBuilder(server.URL).WithRetryPolicy(fastRetries).Do(context.TODO(), server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, int32(1), *calls)
+	})
+	t.Run("Retries on network errors", func(t *testing.T) {
+		server, _ := newFlakyServer(0, http.StatusOK)
+		url := server.URL
+		server.Close()
+		_, err := NewGetBuilder(url).WithRetryPolicy(fastRetries).Do(context.TODO(), nil, nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, executorErrorKind, err.(blperr.StackError).Kind())
+	})
+	t.Run("Honours the Retry-After header", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				res.Header().Set("Retry-After", "1")
+				res.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			res.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+		policy := fastRetries
+		policy.MaxBackoff = 2 * time.Second
+		start := time.Now()
+		_, err := NewGetBuilder(server.URL).WithRetryPolicy(policy).Do(context.TODO(), server.Client(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), calls)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+	t.Run("Does not wait longer than the maximum backoff asked by the Retry-After header", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			res.Header().Set("Retry-After", "86400")
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		start := time.Now()
+		res, err := NewGetBuilder(server.URL).WithRetryPolicy(fastRetries).Do(context.TODO(), server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, int32(1), calls)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+	t.Run("Stops retrying when the next attempt would exceed the context deadline", func(t *testing.T) {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			res.Header().Set("Retry-After", "10")
+			res.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		defer cancel()
+		start := time.Now()
+		_, err := NewGetBuilder(server.URL).Do(ctx, server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, int32(1), calls)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+	t.Run("Stops after the maximum number of attempts with a context deadline", func(t *testing.T) {
+		server, calls := newFlakyServer(5, http.StatusInternalServerError)
+		defer server.Close()
+		ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
+		defer cancel()
+		res, err := NewGetBuilder(server.URL).WithRetryPolicy(fastRetries).Do(ctx, server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		assert.Equal(t, int32(3), *calls)
+	})
+	t.Run("Does not retry with NoRetry and a context deadline", func(t *testing.T) {
+		server, calls := newFlakyServer(5, http.StatusServiceUnavailable)
+		defer server.Close()
+		ctx, cancel := context.WithTimeout(context.TODO(), 200*time.Millisecond)
+		defer cancel()
+		res, err := NewGetBuilder(server.URL).WithRetryPolicy(NoRetry).Do(ctx, server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, KindFromStatusCode(http.StatusServiceUnavailable), err.(blperr.StackError).Kind())
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, int32(1), *calls)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	wait, ok := parseRetryAfter("3")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+
+	wait, ok = parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, ok)
+	assert.Equal(t, time.Duration(0), wait)
+
+	_, ok = parseRetryAfter("soon")
+	assert.False(t, ok)
+}
+
+func TestRequestBuilder_DoRefreshesToken(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token-2" {
+			res.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	var fetched int32
+	provider := clients.NewRefreshingTokenProvider(func() string {
+		return fmt.Sprintf("token-%d", atomic.AddInt32(&fetched, 1))
+	})
+
+	t.Run("Sends the request again with a fresh token on 401", func(t *testing.T) {
+		res, err := NewPostBuilder(server.URL).WithPayload("hello").WithTokenProvider(provider).Do(context.TODO(), server.Client(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		assert.Equal(t, int32(2), fetched)
+	})
+	t.Run("Refreshes the token only once", func(t *testing.T) {
+		res, err := NewGetBuilder(server.URL).WithTokenProvider(provider).Do(context.TODO(), server.Client(), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusNoContent, res.StatusCode)
+		provider.RefreshToken()
+		res, err = NewGetBuilder(server.URL).WithTokenProvider(provider).Do(context.TODO(), server.Client(), nil)
+		assert.NotNil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, int32(4), fetched)
+	})
+	t.Run("Does not refresh a static token provider", func(t *testing.T) {
+		static := clients.TokenProviderFunc(func() string { return "token-1" })
+		_, err := NewGetBuilder(server.URL).WithTokenProvider(static).Do(context.TODO(), server.Client(), nil)
+		assert.Equal(t, KindUnauthorized, err.(blperr.StackError).Kind())
+	})
+}
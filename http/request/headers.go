@@ -0,0 +1,101 @@
+package request
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WithHeader sets a header in the request, replacing any value previously set for this key
+// For example: WithHeader("Accept-Language", "fr-FR")
+func (b *RequestBuilder) WithHeader(key string, value string) *RequestBuilder {
+	if key == "" {
+		b.addError("Empty header name")
+		return b
+	}
+	if b.headers == nil {
+		b.headers = http.Header{}
+	}
+	b.headers.Set(key, value)
+	return b
+}
+
+// WithHeaders allows you to set multiple headers (in the form of key/value pairs) in the request
+// For example: WithHeaders(map[string]string{"Accept-Language": "fr-FR", "Idempotency-Key": "1234"})
+func (b *RequestBuilder) WithHeaders(headers map[string]string) *RequestBuilder {
+	for key, value := range headers {
+		b.WithHeader(key, value)
+	}
+	return b
+}
+
+// WithAccept sets the media types accepted in the response
+// For example: WithAccept("application/json", "text/plain") will set the header "Accept: application/json, text/plain"
+func (b *RequestBuilder) WithAccept(mediaTypes ...string) *RequestBuilder {
+	return b.WithHeader("Accept", strings.Join(mediaTypes, ", "))
+}
+
+// WithCookie adds a cookie in the request
+func (b *RequestBuilder) WithCookie(cookie *http.Cookie) *RequestBuilder {
+	b.cookies = append(b.cookies, cookie)
+	return b
+}
+
+// WithBasicAuth sets the request Authorization header to use HTTP Basic Authentication
+func (b *RequestBuilder) WithBasicAuth(username string, password string) *RequestBuilder {
+	b.basicAuth = url.UserPassword(username, password)
+	return b
+}
+
+// WithTimeout sets a timeout on the request: its context is derived from the one given to BuildWithCancel/Send/Do and
+// is cancelled after the timeout, or as soon as the response body is closed (when sent with Send or Do).
+// The timeout applies to each attempt made by Do. Build rejects the requests with a timeout.
+func (b *RequestBuilder) WithTimeout(timeout time.Duration) *RequestBuilder {
+	if timeout < 0 {
+		b.addError("Negative request timeout [%s]", timeout)
+		return b
+	}
+	b.timeout = timeout
+	return b
+}
+
+func (b *RequestBuilder) setHeaders(req *http.Request) {
+	for key, values := range b.headers {
+		req.Header[key] = append([]string(nil), values...)
+	}
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	if b.basicAuth != nil {
+		password, _ := b.basicAuth.Password()
+		req.SetBasicAuth(b.basicAuth.Username(), password)
+	}
+}
+
+// send sends the request with the client, cancel is called when the response body is closed
+func send(client *http.Client, req *http.Request, cancel context.CancelFunc) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelOnClose{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,84 @@
+package request
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBuilder_BuildWithHeaders(t *testing.T) {
+	request, err := NewGetBuilder(validHost).
+		WithHeader("Accept-Language", "en-GB").
+		WithHeader("Accept-Language", "fr-FR").
+		WithHeaders(map[string]string{"Idempotency-Key": "1234", "X-Custom": "value"}).
+		WithAccept("application/json", "text/plain").
+		Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"fr-FR"}, request.Header.Values("Accept-Language"))
+	assert.Equal(t, "1234", request.Header.Get("Idempotency-Key"))
+	assert.Equal(t, "value", request.Header.Get("X-Custom"))
+	assert.Equal(t, "application/json, text/plain", request.Header.Get("Accept"))
+}
+
+func TestRequestBuilder_BuildWithCookies(t *testing.T) {
+	request, err := NewGetBuilder(validHost).
+		WithCookie(&http.Cookie{Name: "session", Value: "abcd"}).
+		WithCookie(&http.Cookie{Name: "lang", Value: "fr"}).
+		Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "session=abcd; lang=fr", request.Header.Get("Cookie"))
+}
+
+func TestRequestBuilder_BuildWithBasicAuth(t *testing.T) {
+	request, err := NewPostBuilder(validHost).WithBasicAuth("client", "s3cr3t").Build(context.TODO())
+	assert.Equal(t, nil, err)
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "client", username)
+	assert.Equal(t, "s3cr3t", password)
+}
+
+func TestRequestBuilder_WithTimeout(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("BuildWithCancel sets a deadline on the request context", func(t *testing.T) {
+		request, cancel, err := NewGetBuilder(server.URL).WithTimeout(time.Minute).BuildWithCancel(context.TODO())
+		assert.Equal(t, nil, err)
+		deadline, ok := request.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+		cancel()
+		assert.Equal(t, context.Canceled, request.Context().Err())
+	})
+	t.Run("Build rejects a request with a timeout", func(t *testing.T) {
+		request, err := NewGetBuilder(server.URL).WithTimeout(time.Minute).Build(context.TODO())
+		assert.NotNil(t, err)
+		assert.Nil(t, request)
+	})
+	t.Run("The request is cancelled after the timeout", func(t *testing.T) {
+		_, err := NewGetBuilder(server.URL).WithPath("slow").WithTimeout(50*time.Millisecond).Send(context.TODO(), server.Client())
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+	t.Run("The request context is cancelled when the response body is closed", func(t *testing.T) {
+		response, err := NewGetBuilder(server.URL).WithTimeout(time.Minute).Send(context.TODO(), server.Client())
+		assert.Equal(t, nil, err)
+		ctx := response.Request.Context()
+		assert.Nil(t, ctx.Err())
+		response.Body.Close()
+		assert.Equal(t, context.Canceled, ctx.Err())
+	})
+}
@@ -0,0 +1,238 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	jsonContentType = "application/json"
+	formContentType = "application/x-www-form-urlencoded"
+	defaultFileType = "application/octet-stream"
+)
+
+// requestBody describes how the body of the request is produced.
+// In memory bodies are produced by encode, streamed bodies by open.
+type requestBody struct {
+	contentType   string
+	encode        func() ([]byte, error)
+	open          func() (io.ReadCloser, error)
+	contentLength int64
+	// replayable is true when the body can be sent several times (redirects, retries)
+	replayable bool
+}
+
+// attach sets the body on the request
+func (rb *requestBody) attach(req *http.Request) error {
+	if rb.encode != nil {
+		data, err := rb.encode()
+		if err != nil {
+			return err
+		}
+		setReplayableBody(req, data)
+		return nil
+	}
+	body, err := rb.open()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.ContentLength = rb.contentLength
+	if rb.replayable {
+		req.GetBody = rb.open
+	}
+	return nil
+}
+
+// MultipartFile is a file sent in a multipart/form-data request
+type MultipartFile struct {
+	// FieldName is the name of the form field holding the file
+	FieldName string
+	// FileName is the name of the file sent to the server
+	FileName string
+	// ContentType of the file, defaults to application/octet-stream
+	ContentType string
+	// Open returns the content of the file. It is called each time the body is sent,
+	// and the returned reader is closed once its content is written.
+	Open func() (io.ReadCloser, error)
+}
+
+// NewMultipartFile creates a MultipartFile from an in memory content
+func NewMultipartFile(fieldName string, fileName string, content []byte) MultipartFile {
+	return MultipartFile{
+		FieldName: fieldName,
+		FileName:  fileName,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		},
+	}
+}
+
+// WithPayload add an object which will be serialized and add in the request, a nil payload sends no body
+func (b *RequestBuilder) WithPayload(payload interface{}) *RequestBuilder {
+	if payload == nil {
+		b.body = nil
+		return b
+	}
+	b.body = &requestBody{
+		contentType: jsonContentType,
+		encode: func() ([]byte, error) {
+			return json.Marshal(payload)
+		},
+		replayable: true,
+	}
+	return b
+}
+
+// WithFormPayload sends the values url encoded, with the application/x-www-form-urlencoded content type
+func (b *RequestBuilder) WithFormPayload(values url.Values) *RequestBuilder {
+	b.body = &requestBody{
+		contentType: formContentType,
+		encode: func() ([]byte, error) {
+			return []byte(values.Encode()), nil
+		},
+		replayable: true,
+	}
+	return b
+}
+
+// WithRawBody sends the content of the reader as is, with the given content type.
+// In memory readers (*bytes.Buffer, *bytes.Reader, *strings.Reader) are replayable, any other reader
+// is streamed to the server and can only be sent once: the request won't be retried nor follow 307/308 redirects.
+// Use WithStreamBody for large contents which must be replayable.
+func (b *RequestBuilder) WithRawBody(body io.Reader, contentType string) *RequestBuilder {
+	switch v := body.(type) {
+	case nil:
+		b.body = nil
+	case *bytes.Buffer:
+		data := v.Bytes()
+		b.body = &requestBody{contentType: contentType, encode: func() ([]byte, error) { return data, nil }, replayable: true}
+	case *bytes.Reader, *strings.Reader:
+		data, err := io.ReadAll(v)
+		b.body = &requestBody{contentType: contentType, encode: func() ([]byte, error) { return data, err }, replayable: true}
+	default:
+		b.body = &requestBody{
+			contentType: contentType,
+			open: func() (io.ReadCloser, error) {
+				if rc, ok := body.(io.ReadCloser); ok {
+					return rc, nil
+				}
+				return io.NopCloser(body), nil
+			},
+			contentLength: -1,
+		}
+	}
+	return b
+}
+
+// WithStreamBody streams the content returned by open to the server, with the given content type.
+// open is called each time the body is sent, so the request can be retried and follow redirects.
+// contentLength can be -1 when unknown, the body is then sent with a chunked transfer encoding.
+func (b *RequestBuilder) WithStreamBody(open func() (io.ReadCloser, error), contentType string, contentLength int64) *RequestBuilder {
+	b.body = &requestBody{
+		contentType:   contentType,
+		open:          open,
+		contentLength: contentLength,
+		replayable:    true,
+	}
+	return b
+}
+
+// WithMultipart sends a multipart/form-data body made of the fields and the files.
+// The body is streamed, files are read only when the request is sent.
+func (b *RequestBuilder) WithMultipart(fields map[string]string, files ...MultipartFile) *RequestBuilder {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	b.body = &requestBody{
+		contentType: "multipart/form-data; boundary=" + boundary,
+		open: func() (io.ReadCloser, error) {
+			return newMultipartReader(boundary, fields, files), nil
+		},
+		contentLength: -1,
+		replayable:    true,
+	}
+	return b
+}
+
+// multipartReader streams a multipart body through a pipe. The writer goroutine only starts on the first Read,
+// so a body which is closed, or never read, does not leave it blocked.
+type multipartReader struct {
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+	start sync.Once
+	write func(w io.Writer) error
+}
+
+func newMultipartReader(boundary string, fields map[string]string, files []MultipartFile) *multipartReader {
+	pr, pw := io.Pipe()
+	return &multipartReader{
+		pr: pr,
+		pw: pw,
+		write: func(w io.Writer) error {
+			return writeMultipart(w, boundary, fields, files)
+		},
+	}
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	r.start.Do(func() {
+		go func() {
+			r.pw.CloseWithError(r.write(r.pw))
+		}()
+	})
+	return r.pr.Read(p)
+}
+
+// Close stops the writer goroutine, when started
+func (r *multipartReader) Close() error {
+	return r.pr.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func writeMultipart(w io.Writer, boundary string, fields map[string]string, files []MultipartFile) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := writeMultipartFile(writer, file); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func writeMultipartFile(writer *multipart.Writer, file MultipartFile) error {
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = defaultFileType
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(file.FieldName), quoteEscaper.Replace(file.FileName)))
+	header.Set("Content-Type", contentType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	_, err = io.Copy(part, content)
+	return err
+}
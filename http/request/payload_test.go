@@ -0,0 +1,165 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestBuilder_BuildWithoutBody(t *testing.T) {
+	request, err := NewGetBuilder(validHost).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", request.Header.Get("Content-Type"))
+}
+
+func TestRequestBuilder_BuildWithNilPayload(t *testing.T) {
+	request, err := NewPostBuilder(validHost).WithPayload(nil).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", request.Header.Get("Content-Type"))
+	assert.Nil(t, request.Body)
+}
+
+func TestRequestBuilder_BuildWithFormPayload(t *testing.T) {
+	values := url.Values{"grant_type": {"client_credentials"}, "scope": {"read:data"}}
+	request, err := NewPostBuilder(validHost).WithFormPayload(values).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "application/x-www-form-urlencoded", request.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(values.Encode())), request.ContentLength)
+	content, _ := io.ReadAll(request.Body)
+	assert.Equal(t, "grant_type=client_credentials&scope=read%3Adata", string(content))
+}
+
+func TestRequestBuilder_BuildWithRawBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       io.Reader
+		replayable bool
+	}{
+		{"from a bytes buffer", bytes.NewBufferString("raw content"), true},
+		{"from a bytes reader", bytes.NewReader([]byte("raw content")), true},
+		{"from a strings reader", strings.NewReader("raw content"), true},
+		{"from a stream", io.MultiReader(strings.NewReader("raw "), strings.NewReader("content")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := NewPutBuilder(validHost).WithRawBody(tt.body, "text/plain").Build(context.TODO())
+			assert.Equal(t, nil, err)
+			assert.Equal(t, "text/plain", request.Header.Get("Content-Type"))
+			content, _ := io.ReadAll(request.Body)
+			assert.Equal(t, "raw content", string(content))
+			assert.Equal(t, tt.replayable, request.GetBody != nil)
+			if tt.replayable {
+				assert.Equal(t, int64(len("raw content")), request.ContentLength)
+				body, _ := request.GetBody()
+				content, _ = io.ReadAll(body)
+				assert.Equal(t, "raw content", string(content))
+			} else {
+				assert.Equal(t, int64(-1), request.ContentLength)
+			}
+		})
+	}
+}
+
+func TestRequestBuilder_BuildWithStreamBody(t *testing.T) {
+	var opened int32
+	open := func() (io.ReadCloser, error) {
+		atomic.AddInt32(&opened, 1)
+		return io.NopCloser(strings.NewReader("large content")), nil
+	}
+	request, err := NewPostBuilder(validHost).WithStreamBody(open, "application/octet-stream", 13).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "application/octet-stream", request.Header.Get("Content-Type"))
+	assert.Equal(t, int64(13), request.ContentLength)
+	assert.NotNil(t, request.GetBody)
+	assert.Equal(t, int32(1), opened)
+}
+
+func TestRequestBuilder_WithMultipart(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if err := req.ParseMultipartForm(1 << 20); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "1234", req.FormValue("patientId"))
+		file, header, err := req.FormFile("data")
+		if err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := io.ReadAll(file)
+		assert.Equal(t, "device.json", header.Filename)
+		assert.Equal(t, "application/octet-stream", header.Header.Get("Content-Type"))
+		assert.Equal(t, `{"type":"cbg"}`, string(content))
+		res.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	file := NewMultipartFile("data", "device.json", []byte(`{"type":"cbg"}`))
+	request, err := NewPostBuilder(server.URL).
+		WithMultipart(map[string]string{"patientId": "1234"}, file).
+		Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.True(t, strings.HasPrefix(request.Header.Get("Content-Type"), "multipart/form-data; boundary="))
+	response, err := server.Client().Do(request)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusCreated, response.StatusCode)
+}
+
+func TestRequestBuilder_DoDoesNotRetryStreamedBody(t *testing.T) {
+	server, calls := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+	_, err := NewPutBuilder(server.URL).
+		WithRawBody(io.MultiReader(strings.NewReader("content")), "text/plain").
+		WithRetryPolicy(fastRetries).
+		Do(context.TODO(), server.Client(), nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), *calls)
+}
+
+func TestRequestBuilder_BuildWithMultipartDoesNotWriteUnreadBody(t *testing.T) {
+	var opened int32
+	file := MultipartFile{
+		FieldName: "data",
+		FileName:  "device.json",
+		Open: func() (io.ReadCloser, error) {
+			atomic.AddInt32(&opened, 1)
+			return io.NopCloser(strings.NewReader(`{"type":"cbg"}`)), nil
+		},
+	}
+	request, err := NewPostBuilder(validHost).WithMultipart(nil, file).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Nil(t, request.Body.Close())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&opened))
+
+	request, _ = NewPostBuilder(validHost).WithMultipart(nil, file).Build(context.TODO())
+	_, err = request.Body.Read(make([]byte, 1))
+	assert.Nil(t, err)
+	// the writer goroutine, blocked on the pipe, ends when the body is closed
+	assert.Nil(t, request.Body.Close())
+}
+
+func TestRequestBuilder_BuildWithRawBodyConcurrently(t *testing.T) {
+	builder := NewPutBuilder(validHost).WithRawBody(strings.NewReader("raw content"), "text/plain")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, err := builder.Build(context.TODO())
+			assert.Equal(t, nil, err)
+			content, _ := io.ReadAll(request.Body)
+			assert.Equal(t, "raw content", string(content))
+		}()
+	}
+	wg.Wait()
+}
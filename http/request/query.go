@@ -0,0 +1,197 @@
+package request
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdblp/go-common/v2/jepson"
+)
+
+// QueryOption changes the way a query param is added by WithQueryParam
+type QueryOption int
+
+const (
+	// KeepEmpty keeps the query param in the url even when its value is empty (http://host?key=)
+	KeepEmpty QueryOption = iota + 1
+)
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	durationType       = reflect.TypeOf(time.Duration(0))
+	jepsonDurationType = reflect.TypeOf(jepson.Duration(0))
+	stringerType       = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// WithQueryParam adds a query param in the request, replacing any value previously set for this key.
+// The value is formatted according to its type:
+//   - time.Time: RFC3339
+//   - time.Duration and jepson.Duration: duration string (1h30m0s)
+//   - bool, integers, floats and strings: their usual string representation
+//   - fmt.Stringer: the result of String()
+//   - slices and arrays: one query param per item, http://host?key=item1&key=item2
+//   - pointers: the pointed value, nothing is added for a nil pointer
+//
+// Empty values are dropped, unless the KeepEmpty option is given.
+// For example: WithQueryParam("startDate", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) will generate a url like http://host?startDate=2024-01-01T00:00:00Z
+func (b *RequestBuilder) WithQueryParam(key string, value interface{}, opts ...QueryOption) *RequestBuilder {
+	if key == "" {
+		b.addError("Empty query param name for value [%v]", value)
+		return b
+	}
+	values, err := formatQueryValues(reflect.ValueOf(value))
+	if err != nil {
+		b.addError("Invalid query param [%s]: %v", key, err)
+		return b
+	}
+	b.setQueryValues(key, values, hasQueryOption(opts, KeepEmpty))
+	return b
+}
+
+// WithQueryStruct adds the exported fields of a struct (or of a pointer to a struct) as query params.
+// The name of the query param is read from the `url` tag of the field, or defaults to the field name:
+//
+//	type Paging struct {
+//		Cursor string    `url:"cursor,omitempty"` // dropped when empty
+//		Limit  int       `url:"limit"`
+//		From   time.Time `url:"from"`
+//		Secret string    `url:"-"` // ignored
+//	}
+//
+// Values are formatted as in WithQueryParam. Fields of embedded structs are added as if they were declared in the outer struct.
+func (b *RequestBuilder) WithQueryStruct(v interface{}) *RequestBuilder {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return b
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		b.addError("Invalid query struct: expecting a struct, got [%T]", v)
+		return b
+	}
+	b.addQueryStruct(value)
+	return b
+}
+
+func (b *RequestBuilder) addQueryStruct(value reflect.Value) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, tagOptions, _ := strings.Cut(field.Tag.Get("url"), ",")
+		if name == "-" {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if field.Anonymous && name == "" && reflect.Indirect(fieldValue).Kind() == reflect.Struct {
+			if fieldValue.Kind() == reflect.Pointer && fieldValue.IsNil() {
+				continue
+			}
+			b.addQueryStruct(reflect.Indirect(fieldValue))
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		omitEmpty := tagOptions == "omitempty"
+		if omitEmpty && fieldValue.IsZero() {
+			continue
+		}
+		values, err := formatQueryValues(fieldValue)
+		if err != nil {
+			b.addError("Invalid query param [%s]: %v", name, err)
+			continue
+		}
+		b.setQueryValues(name, values, !omitEmpty)
+	}
+}
+
+func (b *RequestBuilder) setQueryValues(key string, values []string, keepEmpty bool) {
+	q := b.baseUrl.Query()
+	q.Del(key)
+	for _, value := range values {
+		if value != "" || keepEmpty {
+			q.Add(key, value)
+		}
+	}
+	if keepEmpty && len(values) == 0 {
+		q.Set(key, "")
+	}
+	b.baseUrl.RawQuery = q.Encode()
+}
+
+func hasQueryOption(opts []QueryOption, option QueryOption) bool {
+	for _, opt := range opts {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// formatQueryValues returns the string representations of a query param value
+func formatQueryValues(value reflect.Value) ([]string, error) {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil, nil
+		}
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return nil, nil
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, fmt.Errorf("unsupported type [%s]", value.Type())
+		}
+		values := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			itemValues, err := formatQueryValues(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, itemValues...)
+		}
+		return values, nil
+	default:
+		formatted, err := formatQueryValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return []string{formatted}, nil
+	}
+}
+
+func formatQueryValue(value reflect.Value) (string, error) {
+	switch value.Type() {
+	case timeType:
+		return value.Interface().(time.Time).Format(time.RFC3339), nil
+	case durationType:
+		return time.Duration(value.Int()).String(), nil
+	case jepsonDurationType:
+		return time.Duration(value.Int()).String(), nil
+	}
+	if value.Type().Implements(stringerType) {
+		return value.Interface().(fmt.Stringer).String(), nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, value.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("unsupported type [%s]", value.Type())
+}
@@ -0,0 +1,132 @@
+package request
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mdblp/go-common/v2/jepson"
+)
+
+type color string
+
+func (c color) String() string {
+	return "color-" + string(c)
+}
+
+func TestRequestBuilder_WithQueryParam(t *testing.T) {
+	date := time.Date(2024, 1, 31, 12, 30, 0, 0, time.UTC)
+	limit := 50
+	var nilPointer *int
+	tests := []struct {
+		name     string
+		value    interface{}
+		opts     []QueryOption
+		expected url.Values
+	}{
+		{"string", "abc", nil, url.Values{"key": {"abc"}}},
+		{"empty string", "", nil, url.Values{}},
+		{"empty string kept", "", []QueryOption{KeepEmpty}, url.Values{"key": {""}}},
+		{"time", date, nil, url.Values{"key": {"2024-01-31T12:30:00Z"}}},
+		{"time in another zone", date.In(time.FixedZone("CET", 3600)), nil, url.Values{"key": {"2024-01-31T13:30:00+01:00"}}},
+		{"duration", 90 * time.Minute, nil, url.Values{"key": {"1h30m0s"}}},
+		{"jepson duration", jepson.Duration(15 * time.Second), nil, url.Values{"key": {"15s"}}},
+		{"bool", true, nil, url.Values{"key": {"true"}}},
+		{"int", -12, nil, url.Values{"key": {"-12"}}},
+		{"uint", uint64(12), nil, url.Values{"key": {"12"}}},
+		{"float", 1.5, nil, url.Values{"key": {"1.5"}}},
+		{"pointer", &limit, nil, url.Values{"key": {"50"}}},
+		{"nil pointer", nilPointer, nil, url.Values{}},
+		{"nil", nil, nil, url.Values{}},
+		{"stringer", color("red"), nil, url.Values{"key": {"color-red"}}},
+		{"slice", []int{1, 2, 3}, nil, url.Values{"key": {"1", "2", "3"}}},
+		{"slice with empty values", []string{"a", "", "b"}, nil, url.Values{"key": {"a", "b"}}},
+		{"slice with empty values kept", []string{"a", ""}, []QueryOption{KeepEmpty}, url.Values{"key": {"a", ""}}},
+		{"slice of times", []time.Time{date}, nil, url.Values{"key": {"2024-01-31T12:30:00Z"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, err := NewGetBuilder(validHost).WithQueryParam("key", tt.value, tt.opts...).Build(context.TODO())
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.expected, request.URL.Query())
+		})
+	}
+}
+
+func TestRequestBuilder_WithQueryParamReplacesValue(t *testing.T) {
+	request, err := NewGetBuilder(validHost).
+		WithQueryParam("key", []string{"a", "b"}).
+		WithQueryParam("key", "c").
+		Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "key=c", request.URL.RawQuery)
+}
+
+func TestRequestBuilder_WithQueryParamErrors(t *testing.T) {
+	_, err := NewGetBuilder(validHost).WithQueryParam("key", map[string]string{"a": "b"}).Build(context.TODO())
+	assert.NotNil(t, err)
+	_, err = NewGetBuilder(validHost).WithQueryParam("", "value").Build(context.TODO())
+	assert.NotNil(t, err)
+}
+
+type paging struct {
+	Cursor string `url:"cursor,omitempty"`
+	Limit  int    `url:"limit"`
+}
+
+type dataQuery struct {
+	paging
+	Paging
+	UserIds   []string        `url:"userIds"`
+	StartDate time.Time       `url:"startDate"`
+	EndDate   *time.Time      `url:"endDate,omitempty"`
+	Window    jepson.Duration `url:"window,omitempty"`
+	Types     string
+	Secret    string `url:"-"`
+	internal  string
+}
+
+type Paging struct {
+	Page int `url:"page,omitempty"`
+}
+
+func TestRequestBuilder_WithQueryStruct(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.Run("Adds the struct fields", func(t *testing.T) {
+		query := dataQuery{
+			paging:    paging{Cursor: "abc", Limit: 10},
+			Paging:    Paging{Page: 2},
+			UserIds:   []string{"123", "456"},
+			StartDate: start,
+			Window:    jepson.Duration(time.Hour),
+			Types:     "cbg",
+			Secret:    "s3cr3t",
+			internal:  "internal",
+		}
+		request, err := NewGetBuilder(validHost).WithQueryStruct(&query).Build(context.TODO())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, url.Values{
+			"page":      {"2"},
+			"userIds":   {"123", "456"},
+			"startDate": {"2024-01-01T00:00:00Z"},
+			"window":    {"1h0m0s"},
+			"Types":     {"cbg"},
+		}, request.URL.Query())
+	})
+	t.Run("Handles omitempty", func(t *testing.T) {
+		request, err := NewGetBuilder(validHost).WithQueryStruct(dataQuery{Paging: Paging{}}).Build(context.TODO())
+		assert.Equal(t, nil, err)
+		assert.Equal(t, url.Values{
+			"userIds":   {""},
+			"startDate": {"0001-01-01T00:00:00Z"},
+			"Types":     {""},
+		}, request.URL.Query())
+	})
+	t.Run("Rejects non struct values", func(t *testing.T) {
+		_, err := NewGetBuilder(validHost).WithQueryStruct("abc").Build(context.TODO())
+		assert.NotNil(t, err)
+	})
+}
@@ -3,14 +3,17 @@ package request
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients"
 	dblcontext "github.com/mdblp/go-common/v2/context"
 )
 
@@ -24,31 +27,62 @@ func RequestBuilderError(err string) blperr.StackError {
 	return blperr.NewWithDetails(apiErrorKind, "failed to build the http request", details)
 }
 
+// requestBuilderErrors returns a StackError holding all the issues met while building the request:
+// the "errors" detail is a multi-error (see errors.Join) and the "error" detail its message
+func requestBuilderErrors(errs []error) blperr.StackError {
+	multiErr := errors.Join(errs...)
+	details := map[string]interface{}{}
+	details["error"] = multiErr.Error()
+	details["errors"] = multiErr
+	return blperr.NewWithDetails(apiErrorKind, "failed to build the http request", details)
+}
+
 type RequestBuilder struct {
-	errorMessage string
-	buildError   bool
-	baseUrl      *url.URL
-	method       string
-	token        string
-	payload      interface{}
+	errs                []error
+	baseUrl             *url.URL
+	method              string
+	token               string
+	tokenProvider       clients.TokenProvider
+	tokenScheme         TokenScheme
+	tokenSchemeDetector TokenSchemeDetector
+	body                *requestBody
+	retryPolicy         *RetryPolicy
+	headers             http.Header
+	cookies             []*http.Cookie
+	basicAuth           *url.Userinfo
+	timeout             time.Duration
 }
 
 func NewBuilder(host string, method string) *RequestBuilder {
 	defaultUrl, _ := url.Parse("http://go.nowhere")
+	builder := &RequestBuilder{baseUrl: defaultUrl, method: method}
+	if method == "" {
+		builder.addError("No http method defined")
+	}
 	if host == "" {
-		return &RequestBuilder{
-			baseUrl:      defaultUrl,
-			buildError:   true,
-			errorMessage: "No client host defined"}
+		builder.addError("No client host defined")
+		return builder
 	}
 	baseUrl, err := url.Parse(host)
 	if err != nil {
-		return &RequestBuilder{
-			baseUrl:      defaultUrl,
-			buildError:   true,
-			errorMessage: fmt.Sprintf("Unable to parse urlString [%s]", host)}
+		builder.addError("Unable to parse urlString [%s]", host)
+		return builder
 	}
-	return &RequestBuilder{baseUrl: baseUrl, buildError: false, method: method}
+	if baseUrl.Scheme == "" {
+		builder.addError("Missing scheme in urlString [%s]", host)
+	} else if baseUrl.Scheme != "http" && baseUrl.Scheme != "https" {
+		builder.addError("Unsupported scheme [%s] in urlString [%s]", baseUrl.Scheme, host)
+	}
+	if baseUrl.Host == "" {
+		builder.addError("Missing host in urlString [%s]", host)
+	}
+	builder.baseUrl = baseUrl
+	return builder
+}
+
+// addError records an issue met while building the request, it will be returned by Build
+func (b *RequestBuilder) addError(format string, args ...interface{}) {
+	b.errs = append(b.errs, fmt.Errorf(format, args...))
 }
 
 // NewGetBuilder initialize a request builder for a 'GET' request
@@ -77,30 +111,46 @@ func NewDeleteBuilder(host string) *RequestBuilder {
 
 // WithPath sets the path of the request url.
 // For example: WithPath("abc", "456") will generate a url like http://host/abc/456
+// A parameter can hold several segments separated by slashes (WithPath("v1/data", "456")), but empty segments
+// and dot segments ("." and "..") are rejected, as path.Join would silently collapse them.
 func (b *RequestBuilder) WithPath(pathParams ...string) *RequestBuilder {
+	for _, pathParam := range pathParams {
+		if err := validatePathParam(pathParam); err != nil {
+			b.errs = append(b.errs, err)
+		}
+	}
 	pathFragments := append([]string{b.baseUrl.Path}, pathParams...)
 	b.baseUrl.Path = path.Join(pathFragments...)
 	return b
 }
 
-// WithPayload add an object which will be serialized and add in the request
-func (b *RequestBuilder) WithPayload(payload interface{}) *RequestBuilder {
-	b.payload = payload
+// WithAuthToken add an authentication token in the request.
+// The header used to send it is chosen from the token, see JwtHeaderDetector.
+func (b *RequestBuilder) WithAuthToken(token string) *RequestBuilder {
+	b.token = token
+	b.tokenProvider = nil
+	b.tokenScheme = DetectScheme
 	return b
 }
 
-// WithAuthToken add an authentication token in the request
-func (b *RequestBuilder) WithAuthToken(token string) *RequestBuilder {
-	b.token = token
+// WithTokenProvider add an authentication token in the request, the token is resolved from the provider when the request is built.
+// When the provider is a clients.RefreshableTokenProvider, Do refreshes the token and sends the request again once
+// if the server answers with a 401.
+func (b *RequestBuilder) WithTokenProvider(provider clients.TokenProvider) *RequestBuilder {
+	b.tokenProvider = provider
+	b.token = ""
 	return b
 }
 
 // WithQueryParams allows you to add multiple query params (in the form of key/value pairs) in the request
 // For example: WithQueryParams(map[string]string{"key1": "val1", "key2": "val2"}) will generate a url like http://host?key1=val1&key2=val2
+// Empty values are dropped, use WithQueryParam with the KeepEmpty option to keep them.
 func (b *RequestBuilder) WithQueryParams(queryParams map[string]string) *RequestBuilder {
 	q := b.baseUrl.Query()
 	for key, value := range queryParams {
-		if value != "" {
+		if key == "" {
+			b.addError("Empty query param name for value [%s]", value)
+		} else if value != "" {
 			q.Set(key, value)
 		}
 	}
@@ -112,6 +162,10 @@ func (b *RequestBuilder) WithQueryParams(queryParams map[string]string) *Request
 // For example: WithQueryParamArray("colors", []string{"red", "green"}) will generate a url like http://host?colors=red&colors=green
 // There is no http standard to pass arrays as query params, but this is a common convention and this how Gin (our preferred http server engine) understand it.
 func (b *RequestBuilder) WithQueryParamArray(tableName string, values []string) *RequestBuilder {
+	if tableName == "" {
+		b.addError("Empty query param name for values %v", values)
+		return b
+	}
 	q := b.baseUrl.Query()
 	for _, value := range values {
 		if value != "" {
@@ -123,41 +177,93 @@ func (b *RequestBuilder) WithQueryParamArray(tableName string, values []string)
 }
 
 // Build instantiates the http.request based on the parameters provided to the builder previously
+//
+// Build returns an error when a timeout is set with WithTimeout, as the context of the request could not be released:
+// use BuildWithCancel, Send or Do instead.
 func (b *RequestBuilder) Build(ctx context.Context) (*http.Request, error) {
-	var err error
-	if b.buildError {
-		return nil, RequestBuilderError(b.errorMessage)
-	}
-	var req *http.Request
-	if b.payload != nil {
-		body, err := json.Marshal(b.payload)
-		if err != nil {
-			return nil, RequestBuilderError(err.Error())
-		}
-		req, err = http.NewRequestWithContext(ctx, b.method, b.baseUrl.String(), bytes.NewBuffer(body))
-	} else {
+	if b.timeout > 0 {
+		return nil, RequestBuilderError("a request with a timeout must be built with BuildWithCancel, or sent with Send or Do")
+	}
+	req, _, err := b.build(ctx)
+	return req, err
+}
+
+// BuildWithCancel instantiates the http.request like Build, and returns the function releasing its context.
+// The caller must call it once done with the request, for example when the response body is closed.
+func (b *RequestBuilder) BuildWithCancel(ctx context.Context) (*http.Request, context.CancelFunc, error) {
+	return b.build(ctx)
+}
+
+// Send builds the request and sends it with the provided client (http.DefaultClient when nil).
+// The caller must close the response body, which releases the context created by WithTimeout.
+func (b *RequestBuilder) Send(ctx context.Context, client *http.Client) (*http.Response, error) {
+	req, cancel, err := b.build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return send(client, req, cancel)
+}
 
-		req, err = http.NewRequestWithContext(ctx, b.method, b.baseUrl.String(), nil)
+// build instantiates the http.request, the returned cancel function releases the request context
+func (b *RequestBuilder) build(ctx context.Context) (*http.Request, context.CancelFunc, error) {
+	if len(b.errs) > 0 {
+		return nil, nil, requestBuilderErrors(b.errs)
 	}
+	cancel := context.CancelFunc(func() {})
+	if b.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+	}
+	req, err := http.NewRequestWithContext(ctx, b.method, b.baseUrl.String(), nil)
 	if err != nil {
-		return nil, RequestBuilderError(err.Error())
+		cancel()
+		return nil, nil, RequestBuilderError(err.Error())
+	}
+	if b.body != nil {
+		if err = b.body.attach(req); err != nil {
+			cancel()
+			return nil, nil, RequestBuilderError(err.Error())
+		}
+		req.Header.Set("Content-Type", b.body.contentType)
 	}
-	if b.token != "" {
-		setAuthHeader(req, b.token)
+	b.setHeaders(req)
+	token := b.token
+	if b.tokenProvider != nil {
+		token = b.tokenProvider.TokenProvide()
+	}
+	if token != "" {
+		b.setAuthHeader(req, token)
 	}
-	req.Header.Set("Content-Type", "application/json")
 	if traceSessionId, ok := dblcontext.GetTraceSessionId(ctx); ok {
 		req.Header.Set(traceSessionHeader, traceSessionId)
 	}
 
-	return req, nil
+	return req, cancel, nil
 }
 
-func setAuthHeader(req *http.Request, authToken string) {
-	/*eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9 is the default shoreline token header*/
-	if strings.Index(authToken, "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9") == 0 {
-		req.Header.Add(LegacyTokenHeader, authToken)
-	} else {
-		req.Header.Add("Authorization", "Bearer "+authToken)
+// setReplayableBody sets the request body along with GetBody and ContentLength,
+// so the http.Client is able to send it again on redirects (307/308) and retries
+func setReplayableBody(req *http.Request, body []byte) {
+	req.ContentLength = int64(len(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+}
+
+// validatePathParam checks a WithPath parameter does not contain segments which path.Join would collapse
+func validatePathParam(pathParam string) error {
+	if pathParam == "" {
+		return errors.New("Empty path segment")
+	}
+	for i, segment := range strings.Split(pathParam, "/") {
+		switch {
+		case segment == "" && i == 0:
+			// leading slash
+		case segment == "":
+			return fmt.Errorf("Empty path segment in [%s]", pathParam)
+		case segment == "." || segment == "..":
+			return fmt.Errorf("Path traversal segment [%s] in [%s]", segment, pathParam)
+		}
 	}
+	return nil
 }
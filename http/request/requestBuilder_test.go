@@ -3,6 +3,8 @@ package request
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -10,6 +12,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients"
 	dblcontext "github.com/mdblp/go-common/v2/context"
 )
 
@@ -19,56 +23,117 @@ const invalidHost = ":thisIsnotAUrl"
 func TestDefaultRequestBuilder(t *testing.T) {
 	t.Run("Building a request with an empty url should log an error", func(t *testing.T) {
 		requestBuilder := NewBuilder("", http.MethodGet)
-		assert.Equal(t, "No client host defined", requestBuilder.errorMessage)
-		assert.Equal(t, true, requestBuilder.buildError)
+		assert.Equal(t, []error{errors.New("No client host defined")}, requestBuilder.errs)
 	})
 	t.Run("Building a request with a malformed url should log an error", func(t *testing.T) {
 		requestBuilder := NewBuilder(invalidHost, http.MethodGet)
-		assert.Equal(t, "Unable to parse urlString [:thisIsnotAUrl]", requestBuilder.errorMessage)
-		assert.Equal(t, true, requestBuilder.buildError)
+		assert.Equal(t, []error{errors.New("Unable to parse urlString [:thisIsnotAUrl]")}, requestBuilder.errs)
+	})
+	t.Run("Building a request with a url without scheme should log an error", func(t *testing.T) {
+		requestBuilder := NewBuilder("ici.ou.labas.org", http.MethodGet)
+		assert.Equal(t, []error{
+			errors.New("Missing scheme in urlString [ici.ou.labas.org]"),
+			errors.New("Missing host in urlString [ici.ou.labas.org]"),
+		}, requestBuilder.errs)
+	})
+	t.Run("Building a request with a non http url should log an error", func(t *testing.T) {
+		requestBuilder := NewBuilder("ftp://ici.ou.labas.org", http.MethodGet)
+		assert.Equal(t, []error{errors.New("Unsupported scheme [ftp] in urlString [ftp://ici.ou.labas.org]")}, requestBuilder.errs)
+	})
+	t.Run("Building a request without method should log an error", func(t *testing.T) {
+		requestBuilder := NewBuilder(validHost, "")
+		assert.Equal(t, []error{errors.New("No http method defined")}, requestBuilder.errs)
 	})
 	t.Run("Building a request with a valid url should create a builder for a GET request", func(t *testing.T) {
 		requestBuilder := NewBuilder(validHost, http.MethodGet)
 		assert.Equal(t, http.MethodGet, requestBuilder.method)
 		assert.Equal(t, &url.URL{Scheme: "http", Host: "ici.ou.labas.org"}, requestBuilder.baseUrl)
-		assert.Equal(t, false, requestBuilder.buildError)
+		assert.Empty(t, requestBuilder.errs)
 	})
 }
 
 func TestNewCustomRequest(t *testing.T) {
 	requestBuilder := NewBuilder(validHost, http.MethodHead)
-	assert.Equal(t, false, requestBuilder.buildError)
+	assert.Empty(t, requestBuilder.errs)
 	assert.Equal(t, http.MethodHead, requestBuilder.method)
 }
 
 func TestNewDeleteRequest(t *testing.T) {
 	requestBuilder := NewDeleteBuilder(validHost)
-	assert.Equal(t, false, requestBuilder.buildError)
+	assert.Empty(t, requestBuilder.errs)
 	assert.Equal(t, http.MethodDelete, requestBuilder.method)
 }
 
 func TestNewGetRequest(t *testing.T) {
 	requestBuilder := NewGetBuilder(validHost)
-	assert.Equal(t, false, requestBuilder.buildError)
+	assert.Empty(t, requestBuilder.errs)
 	assert.Equal(t, http.MethodGet, requestBuilder.method)
 }
 
 func TestNewPostRequest(t *testing.T) {
 	requestBuilder := NewPostBuilder(validHost)
-	assert.Equal(t, false, requestBuilder.buildError)
+	assert.Empty(t, requestBuilder.errs)
 	assert.Equal(t, http.MethodPost, requestBuilder.method)
 }
 
 func TestNewPutRequest(t *testing.T) {
 	requestBuilder := NewPutBuilder(validHost)
-	assert.Equal(t, false, requestBuilder.buildError)
+	assert.Empty(t, requestBuilder.errs)
 	assert.Equal(t, http.MethodPut, requestBuilder.method)
 }
 
 func TestBuildError(t *testing.T) {
 	_, err := NewBuilder("", http.MethodGet).Build(context.TODO())
-	expectedError := RequestBuilderError("No client host defined")
-	assert.Equal(t, expectedError, err)
+	stackErr, ok := err.(blperr.StackError)
+	assert.True(t, ok)
+	assert.Equal(t, apiErrorKind, stackErr.Kind())
+	assert.Equal(t, "failed to build the http request", stackErr.Message())
+	assert.Equal(t, "No client host defined", stackErr.Details()["error"])
+}
+
+func TestBuildErrorAccumulatesAllErrors(t *testing.T) {
+	_, err := NewBuilder("ici.ou.labas.org", "").
+		WithPath("user", "..", "admin").
+		WithPath("a//b").
+		WithQueryParams(map[string]string{"": "value"}).
+		WithHeader("", "value").
+		Build(context.TODO())
+	stackErr := err.(blperr.StackError)
+	multiErr, ok := stackErr.Details()["errors"].(interface{ Unwrap() []error })
+	assert.True(t, ok)
+	assert.Equal(t, []error{
+		errors.New("No http method defined"),
+		errors.New("Missing scheme in urlString [ici.ou.labas.org]"),
+		errors.New("Missing host in urlString [ici.ou.labas.org]"),
+		errors.New("Path traversal segment [..] in [..]"),
+		errors.New("Empty path segment in [a//b]"),
+		errors.New("Empty query param name for value [value]"),
+		errors.New("Empty header name"),
+	}, multiErr.Unwrap())
+}
+
+func TestRequestBuilder_WithPathValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		pathParam string
+		wantErr   bool
+	}{
+		{"single segment", "user", false},
+		{"several segments", "v1/data", false},
+		{"leading slash", "/v1/data", false},
+		{"empty segment", "", true},
+		{"parent segment", "..", true},
+		{"current segment", ".", true},
+		{"traversal in the middle", "user/../admin", true},
+		{"double slashes", "user//admin", true},
+		{"trailing slash", "user/", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGetBuilder(validHost).WithPath(tt.pathParam).Build(context.TODO())
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
 }
 
 func TestDefaultGetRequest(t *testing.T) {
@@ -179,3 +244,79 @@ func TestRequestEnd2End(t *testing.T) {
 	response, _ := client.Do(request)
 	assert.Equal(t, "200 OK", response.Status)
 }
+
+func TestRequestBuilder_BuildWithReplayablePayload(t *testing.T) {
+	payload := map[string]string{"firstName": "John"}
+	request, err := NewPostBuilder(validHost).WithPayload(payload).Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(len(`{"firstName":"John"}`)), request.ContentLength)
+	for i := 0; i < 2; i++ {
+		body, err := request.GetBody()
+		assert.Equal(t, nil, err)
+		content, _ := io.ReadAll(body)
+		assert.Equal(t, `{"firstName":"John"}`, string(content))
+	}
+}
+
+func TestRequestBuilder_RedirectWithPayload(t *testing.T) {
+	payload := map[string]string{"firstName": "John"}
+	var server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/307":
+			http.Redirect(res, req, "/target", http.StatusTemporaryRedirect)
+		case "/308":
+			http.Redirect(res, req, "/target", http.StatusPermanentRedirect)
+		case "/target":
+			var receivedBody map[string]string
+			if err := json.NewDecoder(req.Body).Decode(&receivedBody); err != nil {
+				res.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			assert.Equal(t, payload, receivedBody)
+			assert.Equal(t, int64(len(`{"firstName":"John"}`)), req.ContentLength)
+			res.WriteHeader(http.StatusOK)
+		default:
+			res.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		method   string
+		redirect string
+	}{
+		{http.MethodPost, "307"},
+		{http.MethodPost, "308"},
+		{http.MethodPut, "307"},
+		{http.MethodPut, "308"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" with a "+tt.redirect+" redirect", func(t *testing.T) {
+			request, err := NewBuilder(server.URL, tt.method).WithPath(tt.redirect).WithPayload(payload).Build(context.TODO())
+			assert.Equal(t, nil, err)
+			response, err := server.Client().Do(request)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, http.StatusOK, response.StatusCode)
+			assert.Equal(t, "/target", response.Request.URL.Path)
+		})
+	}
+}
+
+func TestRequestBuilder_BuildWithTokenProvider(t *testing.T) {
+	calls := 0
+	provider := clients.TokenProviderFunc(func() string {
+		calls++
+		return "providedToken"
+	})
+	builder := NewGetBuilder(validHost).WithTokenProvider(provider)
+	assert.Equal(t, 0, calls)
+	request, err := builder.Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Bearer providedToken", request.Header.Get("Authorization"))
+	assert.Equal(t, 1, calls)
+
+	request, err = builder.WithAuthToken("staticToken").Build(context.TODO())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Bearer staticToken", request.Header.Get("Authorization"))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,88 @@
+package request
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients/status"
+)
+
+// Kinds of the errors returned when a service answers with a non 2xx status code
+const (
+	KindBadRequest         = "bad-request"
+	KindUnauthorized       = "unauthorized"
+	KindForbidden          = "forbidden"
+	KindNotFound           = "not-found"
+	KindConflict           = "conflict"
+	KindTooManyRequests    = "too-many-requests"
+	KindClientError        = "client-error"
+	KindServiceUnavailable = "service-unavailable"
+	KindServerError        = "server-error"
+	KindUnexpectedStatus   = "unexpected-status"
+)
+
+// maximum number of bytes read from an error response body
+const maxErrorBodySize = 64 * 1024
+
+// KindFromStatusCode returns the StackError kind matching an http status code
+func KindFromStatusCode(code int) string {
+	switch {
+	case code == http.StatusBadRequest:
+		return KindBadRequest
+	case code == http.StatusUnauthorized:
+		return KindUnauthorized
+	case code == http.StatusForbidden:
+		return KindForbidden
+	case code == http.StatusNotFound:
+		return KindNotFound
+	case code == http.StatusConflict:
+		return KindConflict
+	case code == http.StatusTooManyRequests:
+		return KindTooManyRequests
+	case code >= 400 && code < 500:
+		return KindClientError
+	case code == http.StatusServiceUnavailable, code == http.StatusGatewayTimeout, code == http.StatusBadGateway:
+		return KindServiceUnavailable
+	case code >= 500:
+		return KindServerError
+	default:
+		return KindUnexpectedStatus
+	}
+}
+
+// NewResponseError reads the body of a non 2xx response and turns it into a StackError.
+// The kind of the error is derived from the status code (see KindFromStatusCode) and the details hold:
+//   - "status": the status.Status sent by the remote service (or built from the response status line)
+//   - "url" and "method" of the request
+//   - "traceSessionId" when the request carried one
+//
+// The caller remains in charge of closing the response body.
+func NewResponseError(res *http.Response) blperr.StackError {
+	remoteStatus := status.StatusFromResponse(res)
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	var bodyStatus status.Status
+	if err := json.Unmarshal(body, &bodyStatus); err == nil && bodyStatus.Code != 0 {
+		remoteStatus = bodyStatus
+	} else if err := json.Unmarshal(body, &struct {
+		Status *status.Status `json:"status"`
+	}{Status: &bodyStatus}); err == nil && bodyStatus.Code != 0 {
+		// body is an ApiStatus like object
+		remoteStatus = bodyStatus
+	}
+
+	details := map[string]interface{}{
+		"status": remoteStatus,
+	}
+	message := "unexpected response status " + res.Status
+	if req := res.Request; req != nil {
+		details["url"] = req.URL.String()
+		details["method"] = req.Method
+		if traceSessionId := req.Header.Get(traceSessionHeader); traceSessionId != "" {
+			details["traceSessionId"] = traceSessionId
+		}
+		message += " from " + req.Method + " " + req.URL.String()
+	}
+	return blperr.NewWithDetails(KindFromStatusCode(res.StatusCode), message, details)
+}
@@ -0,0 +1,83 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mdblp/go-common/v2/blperr"
+	"github.com/mdblp/go-common/v2/clients/status"
+	dblcontext "github.com/mdblp/go-common/v2/context"
+)
+
+func TestKindFromStatusCode(t *testing.T) {
+	tests := []struct {
+		code int
+		kind string
+	}{
+		{http.StatusBadRequest, KindBadRequest},
+		{http.StatusUnauthorized, KindUnauthorized},
+		{http.StatusForbidden, KindForbidden},
+		{http.StatusNotFound, KindNotFound},
+		{http.StatusConflict, KindConflict},
+		{http.StatusTooManyRequests, KindTooManyRequests},
+		{http.StatusTeapot, KindClientError},
+		{http.StatusBadGateway, KindServiceUnavailable},
+		{http.StatusServiceUnavailable, KindServiceUnavailable},
+		{http.StatusGatewayTimeout, KindServiceUnavailable},
+		{http.StatusInternalServerError, KindServerError},
+		{http.StatusMovedPermanently, KindUnexpectedStatus},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.code), func(t *testing.T) {
+			assert.Equal(t, tt.kind, KindFromStatusCode(tt.code))
+		})
+	}
+}
+
+func TestNewResponseError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/status":
+			res.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(res, `{"code":404,"reason":"user not found"}`)
+		case "/api-status":
+			res.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(res, `{"status":{"code":503,"reason":"database unavailable"},"version":"1.0.0"}`)
+		default:
+			res.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(res, "go away")
+		}
+	}))
+	defer server.Close()
+	ctx := dblcontext.SetTraceSessionId(context.TODO(), "123456789456")
+
+	t.Run("Uses the status sent by the remote service", func(t *testing.T) {
+		_, err := NewGetBuilder(server.URL).WithPath("status").Do(ctx, server.Client(), nil)
+		stackErr, ok := err.(blperr.StackError)
+		assert.True(t, ok)
+		assert.Equal(t, KindNotFound, stackErr.Kind())
+		assert.Equal(t, status.NewStatus(http.StatusNotFound, "user not found"), stackErr.Details()["status"])
+		assert.Equal(t, server.URL+"/status", stackErr.Details()["url"])
+		assert.Equal(t, http.MethodGet, stackErr.Details()["method"])
+		assert.Equal(t, "123456789456", stackErr.Details()["traceSessionId"])
+	})
+	t.Run("Uses the status of an api status body", func(t *testing.T) {
+		_, err := NewGetBuilder(server.URL).WithPath("api-status").WithRetryPolicy(NoRetry).Do(ctx, server.Client(), nil)
+		stackErr := err.(blperr.StackError)
+		assert.Equal(t, KindServiceUnavailable, stackErr.Kind())
+		assert.Equal(t, status.NewStatus(http.StatusServiceUnavailable, "database unavailable"), stackErr.Details()["status"])
+	})
+	t.Run("Builds the status from the response when the body is not a status", func(t *testing.T) {
+		_, err := NewDeleteBuilder(server.URL).WithPath("other").Do(context.TODO(), server.Client(), nil)
+		stackErr := err.(blperr.StackError)
+		assert.Equal(t, KindForbidden, stackErr.Kind())
+		assert.Equal(t, http.StatusForbidden, stackErr.Details()["status"].(status.Status).Code)
+		assert.Equal(t, http.MethodDelete, stackErr.Details()["method"])
+		assert.NotContains(t, stackErr.Details(), "traceSessionId")
+	})
+}
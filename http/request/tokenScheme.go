@@ -0,0 +1,101 @@
+package request
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// TokenScheme tells how an authentication token is sent in the request
+type TokenScheme int
+
+const (
+	// DetectScheme lets the TokenSchemeDetector of the builder choose the scheme from the token
+	DetectScheme TokenScheme = iota
+	// LegacyScheme sends the token in the x-tidepool-session-token header (shoreline tokens)
+	LegacyScheme
+	// BearerScheme sends the token in the Authorization header as a bearer token (OAuth tokens)
+	BearerScheme
+)
+
+// TokenSchemeDetector chooses the scheme used to send a token, it should return LegacyScheme or BearerScheme
+type TokenSchemeDetector interface {
+	DetectScheme(token string) TokenScheme
+}
+
+// TokenSchemeDetectorFunc is an adapter to use a function as a TokenSchemeDetector
+type TokenSchemeDetectorFunc func(token string) TokenScheme
+
+func (f TokenSchemeDetectorFunc) DetectScheme(token string) TokenScheme {
+	return f(token)
+}
+
+// JwtHeaderDetector is the default TokenSchemeDetector: it parses the header of the token (a JWT)
+// and sends the HMAC signed tokens (alg HS256, HS384 and HS512), issued by shoreline, in the legacy header.
+// Any other token, including the ones which are not JWTs, is sent as a bearer token.
+var JwtHeaderDetector TokenSchemeDetector = TokenSchemeDetectorFunc(detectFromJwtHeader)
+
+func detectFromJwtHeader(token string) TokenScheme {
+	encodedHeader, _, _ := strings.Cut(token, ".")
+	header, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encodedHeader, "="))
+	if err != nil {
+		return BearerScheme
+	}
+	var jwtHeader struct {
+		Algorithm string `json:"alg"`
+	}
+	// the decoder stops at the end of the json object, ignoring any trailing byte
+	if err := json.NewDecoder(bytes.NewReader(header)).Decode(&jwtHeader); err != nil {
+		return BearerScheme
+	}
+	if strings.HasPrefix(jwtHeader.Algorithm, "HS") {
+		return LegacyScheme
+	}
+	return BearerScheme
+}
+
+// WithLegacyToken add an authentication token in the request, sent in the x-tidepool-session-token header
+func (b *RequestBuilder) WithLegacyToken(token string) *RequestBuilder {
+	b.WithAuthToken(token)
+	b.tokenScheme = LegacyScheme
+	return b
+}
+
+// WithBearerToken add an authentication token in the request, sent in the Authorization header as a bearer token
+func (b *RequestBuilder) WithBearerToken(token string) *RequestBuilder {
+	b.WithAuthToken(token)
+	b.tokenScheme = BearerScheme
+	return b
+}
+
+// WithTokenScheme forces the scheme used to send the token set with WithAuthToken or WithTokenProvider.
+// With DetectScheme, the scheme is chosen by the detector given to WithTokenSchemeDetector.
+// WithAuthToken resets the scheme to DetectScheme, so it must be called before WithTokenScheme.
+func (b *RequestBuilder) WithTokenScheme(scheme TokenScheme) *RequestBuilder {
+	b.tokenScheme = scheme
+	return b
+}
+
+// WithTokenSchemeDetector replaces the JwtHeaderDetector used to choose how the token is sent
+func (b *RequestBuilder) WithTokenSchemeDetector(detector TokenSchemeDetector) *RequestBuilder {
+	b.tokenSchemeDetector = detector
+	return b
+}
+
+func (b *RequestBuilder) setAuthHeader(req *http.Request, authToken string) {
+	scheme := b.tokenScheme
+	if scheme == DetectScheme {
+		detector := b.tokenSchemeDetector
+		if detector == nil {
+			detector = JwtHeaderDetector
+		}
+		scheme = detector.DetectScheme(authToken)
+	}
+	if scheme == LegacyScheme {
+		req.Header.Add(LegacyTokenHeader, authToken)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+authToken)
+	}
+}
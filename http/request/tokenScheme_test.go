@@ -0,0 +1,84 @@
+package request
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func jwtWithHeader(header string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + ".eyJzdWIiOiIxMjM0In0.signature"
+}
+
+func TestJwtHeaderDetector(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		expected TokenScheme
+	}{
+		{"shoreline token", jwtWithHeader(`{"alg":"HS256","typ":"JWT"}`), LegacyScheme},
+		{"HS256 token with another header ordering", jwtWithHeader(`{"typ":"JWT","alg":"HS256"}`), LegacyScheme},
+		{"HS256 token with a kid", jwtWithHeader(`{"alg":"HS256","kid":"legacy-1","typ":"JWT"}`), LegacyScheme},
+		{"HS512 token", jwtWithHeader(`{"alg":"HS512"}`), LegacyScheme},
+		{"Auth0 token", jwtWithHeader(`{"alg":"RS256","typ":"JWT","kid":"abcd"}`), BearerScheme},
+		{"opaque token", "thisIsAGreatBearerToken", BearerScheme},
+		{"token with an invalid header", "bm90IGpzb24.eyJzdWIiOiIxMjM0In0.signature", BearerScheme},
+		{"empty token", "", BearerScheme},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, JwtHeaderDetector.DetectScheme(tt.token))
+		})
+	}
+}
+
+func TestRequestBuilder_TokenScheme(t *testing.T) {
+	legacyToken := jwtWithHeader(`{"typ":"JWT","alg":"HS256"}`)
+	bearerToken := jwtWithHeader(`{"alg":"RS256","typ":"JWT"}`)
+
+	t.Run("Detects the header from the token", func(t *testing.T) {
+		request, _ := NewGetBuilder(validHost).WithAuthToken(legacyToken).Build(context.TODO())
+		assert.Equal(t, legacyToken, request.Header.Get(LegacyTokenHeader))
+		assert.Equal(t, "", request.Header.Get("Authorization"))
+
+		request, _ = NewGetBuilder(validHost).WithAuthToken(bearerToken).Build(context.TODO())
+		assert.Equal(t, "Bearer "+bearerToken, request.Header.Get("Authorization"))
+		assert.Equal(t, "", request.Header.Get(LegacyTokenHeader))
+	})
+	t.Run("WithLegacyToken forces the legacy header", func(t *testing.T) {
+		request, _ := NewGetBuilder(validHost).WithLegacyToken(bearerToken).Build(context.TODO())
+		assert.Equal(t, bearerToken, request.Header.Get(LegacyTokenHeader))
+		assert.Equal(t, "", request.Header.Get("Authorization"))
+	})
+	t.Run("WithBearerToken forces the authorization header", func(t *testing.T) {
+		request, _ := NewGetBuilder(validHost).WithBearerToken(legacyToken).Build(context.TODO())
+		assert.Equal(t, "Bearer "+legacyToken, request.Header.Get("Authorization"))
+		assert.Equal(t, "", request.Header.Get(LegacyTokenHeader))
+	})
+	t.Run("WithAuthToken goes back to detection", func(t *testing.T) {
+		request, _ := NewGetBuilder(validHost).WithBearerToken(legacyToken).WithAuthToken(legacyToken).Build(context.TODO())
+		assert.Equal(t, legacyToken, request.Header.Get(LegacyTokenHeader))
+	})
+	t.Run("Uses a custom detector", func(t *testing.T) {
+		detector := TokenSchemeDetectorFunc(func(token string) TokenScheme {
+			return LegacyScheme
+		})
+		request, _ := NewGetBuilder(validHost).WithAuthToken("opaque").WithTokenSchemeDetector(detector).Build(context.TODO())
+		assert.Equal(t, "opaque", request.Header.Get(LegacyTokenHeader))
+	})
+	t.Run("Forces the scheme of a token provider", func(t *testing.T) {
+		request, _ := NewGetBuilder(validHost).
+			WithTokenProvider(staticTokenProvider(legacyToken)).
+			WithTokenScheme(BearerScheme).
+			Build(context.TODO())
+		assert.Equal(t, "Bearer "+legacyToken, request.Header.Get("Authorization"))
+	})
+}
+
+type staticTokenProvider string
+
+func (s staticTokenProvider) TokenProvide() string {
+	return string(s)
+}
@@ -0,0 +1,127 @@
+// Package lru provides a bounded least recently used cache whose entries expire
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the metrics of a Cache
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Size is the current number of entries
+	Size int
+}
+
+// Cache is a bounded LRU cache, safe for concurrent use. Each entry has its own expiration.
+type Cache[K comparable, V any] struct {
+	capacity int
+	now      func() time.Time
+	mu       sync.Mutex
+	order    *list.List
+	items    map[K]*list.Element
+	hits     atomic.Uint64
+	misses   atomic.Uint64
+}
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// New creates a cache holding at most capacity entries, the least recently used is evicted when it is full
+func New[K comparable, V any](capacity int) *Cache[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache[K, V]{
+		capacity: capacity,
+		now:      time.Now,
+		order:    list.New(),
+		items:    make(map[K]*list.Element, capacity),
+	}
+}
+
+// Get returns the value of a key, unless it is missing or expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry[K, V])
+		if c.now().Before(e.expiresAt) {
+			c.order.MoveToFront(element)
+			c.hits.Add(1)
+			return e.value, true
+		}
+		c.removeElement(element)
+	}
+	c.misses.Add(1)
+	var zero V
+	return zero, false
+}
+
+// Add sets the value of a key until expiresAt, a value which is already expired is not added
+func (c *Cache[K, V]) Add(key K, value V, expiresAt time.Time) {
+	if !c.now().Before(expiresAt) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		element.Value = &entry[K, V]{key: key, value: value, expiresAt: expiresAt}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+	if c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Remove removes a key from the cache
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// RemoveFunc removes the entries matching a predicate
+func (c *Cache[K, V]) RemoveFunc(match func(key K, value V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		if e := element.Value.(*entry[K, V]); match(e.key, e.value) {
+			c.removeElement(element)
+		}
+		element = next
+	}
+}
+
+// Purge removes all the entries, the hits and misses are kept
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[K]*list.Element, c.capacity)
+}
+
+// Stats returns the hits, misses and size of the cache
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+// removeElement removes an element, c.mu must be held
+func (c *Cache[K, V]) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.items, element.Value.(*entry[K, V]).key)
+}
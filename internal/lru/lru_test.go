@@ -0,0 +1,49 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	cache := New[string, int](2)
+	cache.now = func() time.Time { return now }
+
+	cache.Add("a", 1, now.Add(time.Minute))
+	cache.Add("b", 2, now.Add(time.Hour))
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	// b is the least recently used
+	cache.Add("c", 3, now.Add(time.Hour))
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+
+	// expired entries are removed
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	cache.Add("d", 4, now)
+	_, ok = cache.Get("d")
+	assert.False(t, ok)
+
+	cache.Add("c", 30, now.Add(time.Hour))
+	value, _ = cache.Get("c")
+	assert.Equal(t, 30, value)
+	assert.Equal(t, Stats{Hits: 3, Misses: 3, Size: 1}, cache.Stats())
+
+	cache.Add("e", 5, now.Add(time.Hour))
+	cache.RemoveFunc(func(key string, value int) bool { return value > 10 })
+	_, ok = cache.Get("c")
+	assert.False(t, ok)
+	cache.Remove("e")
+	cache.Add("f", 6, now.Add(time.Hour))
+	cache.Purge()
+	assert.Equal(t, 0, cache.Stats().Size)
+}